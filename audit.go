@@ -0,0 +1,59 @@
+package requestmigrations
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultRequestIDHeader is the header the request ID recorded in audit
+// entries is read from when RequestIDHeader isn't set.
+const defaultRequestIDHeader = "X-Request-ID"
+
+// AuditEntry describes a single migration applied to a payload. From and To
+// are the versions the migration moved the payload between, so response
+// entries usually go from a newer version to an older one.
+type AuditEntry struct {
+	RequestID string
+	From      string
+	To        string
+	Handler   string
+	Migration string
+	Direction Direction
+	Timestamp time.Time
+}
+
+// AuditSink records every migration applied to a payload, e.g. for
+// compliance. Record is called synchronously on the request path.
+type AuditSink interface {
+	Record(entry AuditEntry)
+}
+
+func (rm *RequestMigration) requestID(r *http.Request) string {
+	header := rm.opts.RequestIDHeader
+	if isStringEmpty(header) {
+		header = defaultRequestIDHeader
+	}
+
+	return r.Header.Get(header)
+}
+
+// record emits an audit entry for the migration step if an audit sink is
+// configured, and collects its metric labels. It's called once the step's
+// migration has run.
+func (m *migrator) record(handler string, step migrationStep, direction Direction) {
+	m.collectLabels(step.migration)
+
+	if m.auditSink == nil {
+		return
+	}
+
+	m.auditSink.Record(AuditEntry{
+		RequestID: m.requestID,
+		From:      step.from.String(),
+		To:        step.to.String(),
+		Handler:   handler,
+		Migration: migrationName(step.migration),
+		Direction: direction,
+		Timestamp: clockOrDefault(m.clock).Now(),
+	})
+}
@@ -0,0 +1,133 @@
+package requestmigrations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// VersionedPayload is a single payload tagged with the API version it was
+// produced with, e.g. an event consumed from a message queue.
+type VersionedPayload struct {
+	Version string
+	Body    []byte
+	Handler string
+}
+
+// MigrateBatch migrates every item in the batch from its own version to the
+// current version, applying the request migrations registered for each
+// item's handler. The migrated bodies are returned in the same order as
+// items.
+func (rm *RequestMigration) MigrateBatch(items []VersionedPayload) ([][]byte, error) {
+	migrators, err := rm.batchMigrators(items)
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := make([][]byte, len(items))
+	for i, item := range items {
+		data, err := migrators[item.Version].migratePayload(item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+
+		bodies[i] = data
+	}
+
+	return bodies, nil
+}
+
+// MigrateBatchParallel is MigrateBatch with the items migrated by up to
+// concurrency goroutines, e.g. for large batches mixing handlers and
+// versions. Migrations, and the AuditSink if one is set, must be safe for
+// concurrent use. The migrated bodies are returned in the same order as
+// items, and when several items fail the first one's error is returned.
+func (rm *RequestMigration) MigrateBatchParallel(items []VersionedPayload, concurrency int) ([][]byte, error) {
+	migrators, err := rm.batchMigrators(items)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency > len(items) {
+		concurrency = len(items)
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	bodies := make([][]byte, len(items))
+	errs := make([]error, len(items))
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indices {
+				bodies[i], errs[i] = migrators[items[i].Version].migratePayload(items[i])
+			}
+		}()
+	}
+
+	for i := range items {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+
+	return bodies, nil
+}
+
+// batchMigrators builds a migrator for every version in items, which must
+// all be registered. Most batches only carry a handful of distinct versions,
+// so each chain is built once and reused for every item with the same
+// version.
+func (rm *RequestMigration) batchMigrators(items []VersionedPayload) (map[string]*migrator, error) {
+	to := rm.getCurrentVersion()
+
+	migrators := make(map[string]*migrator)
+	for i, item := range items {
+		if _, ok := migrators[item.Version]; ok {
+			continue
+		}
+
+		from := rm.newVersion(item.Version)
+		m, err := rm.newMigrator(from, to)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+
+		if !rm.isKnownVersion(from) {
+			return nil, fmt.Errorf("item %d: %w", i, ErrUnknownVersion)
+		}
+
+		migrators[item.Version] = m
+	}
+
+	return migrators, nil
+}
+
+// migratePayload applies the request migrations of item's handler to its
+// body. m isn't modified, so it can be shared by concurrent calls.
+func (m *migrator) migratePayload(item VersionedPayload) ([]byte, error) {
+	if m.from.Equal(m.to) {
+		return item.Body, nil
+	}
+
+	// metric labels are collected per payload.
+	pm := *m
+	pm.labels = nil
+
+	data, _, err := pm.applyRequestMigrations(context.Background(), item.Body, http.Header{}, item.Handler)
+	return data, err
+}
@@ -0,0 +1,50 @@
+package requestmigrations
+
+import (
+	"math/rand"
+	"net/http"
+)
+
+// fallbackVersion returns the version of requests that don't specify one:
+// the canary version for a CanaryWeight fraction of them, the default version
+// otherwise. The choice is stored on the request's context so its request and
+// response are migrated with the same version.
+func (rm *RequestMigration) fallbackVersion(req *http.Request) string {
+	if isStringEmpty(rm.opts.CanaryVersion) || rm.opts.CanaryWeight <= 0 {
+		return rm.defaultVersion()
+	}
+
+	canary, ok := req.Context().Value(canaryKey).(bool)
+	if !ok {
+		canary = rm.canaryFloat() < rm.opts.CanaryWeight
+		setContextValue(req, canaryKey, canary)
+	}
+
+	if canary {
+		return rm.opts.CanaryVersion
+	}
+
+	return rm.defaultVersion()
+}
+
+// defaultVersion returns DefaultVersion, or the initial version when it's
+// unset.
+func (rm *RequestMigration) defaultVersion() string {
+	if isStringEmpty(rm.opts.DefaultVersion) {
+		return rm.iv
+	}
+
+	return rm.opts.DefaultVersion
+}
+
+func (rm *RequestMigration) canaryFloat() float64 {
+	if rm.opts.CanaryRand == nil {
+		return rand.Float64()
+	}
+
+	// rand.Rand isn't safe for concurrent use.
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.opts.CanaryRand.Float64()
+}
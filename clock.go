@@ -0,0 +1,24 @@
+package requestmigrations
+
+import "time"
+
+// Clock tells the time. It's used to time migrations and timestamp audit
+// entries, so tests can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// clockOrDefault returns c, or the real clock when c is nil.
+func clockOrDefault(c Clock) Clock {
+	if c == nil {
+		return realClock{}
+	}
+
+	return c
+}
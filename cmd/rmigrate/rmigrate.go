@@ -0,0 +1,100 @@
+// Package rmigrate is a command line tool migrating payloads between API
+// versions offline, e.g. JSON dumps taken while an old version was current.
+// Migrations are defined in Go, so programs build their own tool by calling
+// Main with the options and a function registering their migrations:
+//
+//	func main() {
+//		rmigrate.Main(opts, func(rm *rms.RequestMigration) error {
+//			return rm.RegisterMigrations(migrations)
+//		})
+//	}
+//
+// The tool reads the payload from the file named by its argument, or from
+// stdin without one, and writes the migrated payload to stdout:
+//
+//	rmigrate --from 2023-03-01 --to 2023-05-01 --handler createUser dump.json
+//
+// Without --handler only migrations that aren't specific to a handler, e.g.
+// those named RequestXxx or ResponseXxx, are applied.
+package rmigrate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	rms "github.com/subomi/requestmigrations"
+)
+
+// Main runs the tool with the process's arguments, stdin and stdout and exits
+// with a non-zero status when it fails.
+func Main(opts *rms.RequestMigrationOptions, register func(rm *rms.RequestMigration) error) {
+	err := Run(os.Args[1:], os.Stdin, os.Stdout, opts, register)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rmigrate:", err)
+		os.Exit(1)
+	}
+}
+
+// Run parses args, builds a RequestMigration from opts and register, and
+// migrates the payload read from the file named in args, or from stdin, with
+// RequestMigration.Convert, writing the result to stdout.
+func Run(args []string, stdin io.Reader, stdout io.Writer, opts *rms.RequestMigrationOptions, register func(rm *rms.RequestMigration) error) error {
+	fs := flag.NewFlagSet("rmigrate", flag.ContinueOnError)
+	from := fs.String("from", "", "version the payload is in")
+	to := fs.String("to", "", "version to migrate the payload to")
+	handler := fs.String("handler", "", "handler whose migrations are applied")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" || *to == "" {
+		return errors.New("--from and --to are required")
+	}
+
+	if fs.NArg() > 1 {
+		return errors.New("at most one file can be migrated")
+	}
+
+	rm, err := rms.NewRequestMigration(opts)
+	if err != nil {
+		return err
+	}
+
+	if register != nil {
+		if err := register(rm); err != nil {
+			return err
+		}
+	}
+
+	in := stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		in = f
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	data, err = rm.Convert(*from, *to, *handler, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = stdout.Write(data)
+	return err
+}
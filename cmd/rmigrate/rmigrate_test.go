@@ -0,0 +1,86 @@
+package rmigrate
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rms "github.com/subomi/requestmigrations"
+)
+
+func register(rm *rms.RequestMigration) error {
+	rename := func(from, to string) rms.MigrateFunc {
+		return rms.MigrateFunc(func(data []byte, h http.Header) ([]byte, http.Header, error) {
+			data, err := rms.ApplyFieldTransforms(data, rms.RenameField(from, to))
+			return data, h, err
+		})
+	}
+
+	err := rm.RegisterMigrations(rms.MigrationStore{"2023-01-01": rms.Migrations{}})
+	if err != nil {
+		return err
+	}
+
+	err = rm.RegisterFunc("2023-02-01", "createUser", rename("name", "full_name"), rename("full_name", "name"))
+	if err != nil {
+		return err
+	}
+
+	return rm.RegisterFunc("2023-03-01", "createUser", rename("username", "email"), rename("email", "username"))
+}
+
+func Test_Run(t *testing.T) {
+	opts := &rms.RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  rms.DateFormat,
+	}
+
+	path := filepath.Join(t.TempDir(), "dump.json")
+	err := os.WriteFile(path, []byte(`{"name":"Convoy","username":"engineering@getconvoy.io"}`), 0o600)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		args     []string
+		stdin    string
+		expected string
+	}{
+		"forward from file": {
+			args:     []string{"--from", "2023-01-01", "--to", "2023-03-01", "--handler", "createUser", path},
+			expected: `{"full_name":"Convoy","email":"engineering@getconvoy.io"}`,
+		},
+		"between old versions": {
+			args:     []string{"--from", "2023-01-01", "--to", "2023-02-01", "--handler", "createUser", path},
+			expected: `{"full_name":"Convoy","username":"engineering@getconvoy.io"}`,
+		},
+		"backward from stdin": {
+			args:     []string{"--from", "2023-03-01", "--to", "2023-01-01", "--handler", "createUser"},
+			stdin:    `{"full_name":"Convoy","email":"engineering@getconvoy.io"}`,
+			expected: `{"name":"Convoy","username":"engineering@getconvoy.io"}`,
+		},
+		"other handler": {
+			args:     []string{"--from", "2023-01-01", "--to", "2023-03-01", "--handler", "getUser", path},
+			expected: `{"name":"Convoy","username":"engineering@getconvoy.io"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Run(tc.args, strings.NewReader(tc.stdin), &out, opts, register)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.expected, out.String())
+		})
+	}
+
+	var out bytes.Buffer
+	err = Run([]string{"--to", "2023-03-01"}, strings.NewReader("{}"), &out, opts, register)
+	require.Error(t, err)
+
+	err = Run([]string{"--from", "2022-01-01", "--to", "2023-03-01"}, strings.NewReader("{}"), &out, opts, register)
+	require.ErrorIs(t, err, rms.ErrInvalidVersion)
+}
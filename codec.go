@@ -0,0 +1,84 @@
+package requestmigrations
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ResponseCodec encodes migrated JSON responses in the format clients of a
+// version expect, e.g. XML for clients that predate JSON, see
+// ResponseCodecs.
+type ResponseCodec interface {
+	// ContentType is the media type of the encoded responses, e.g.
+	// "application/xml".
+	ContentType() string
+
+	// Encode returns the JSON body data in the codec's format.
+	Encode(data []byte) ([]byte, error)
+}
+
+// responseCodec returns the codec responses to r, on version v, are encoded
+// with, if any. Requests whose Accept header doesn't accept the codec's
+// media type get JSON.
+func (rm *RequestMigration) responseCodec(r *http.Request, v *Version) (ResponseCodec, bool) {
+	if len(rm.opts.ResponseCodecs) == 0 {
+		return nil, false
+	}
+
+	var codec ResponseCodec
+	for version, c := range rm.opts.ResponseCodecs {
+		if rm.newVersion(version).Equal(v) {
+			codec = c
+			break
+		}
+	}
+
+	if codec == nil || !accepts(r.Header, codec.ContentType()) {
+		return nil, false
+	}
+
+	return codec, true
+}
+
+// encodeResponse encodes res's body with codec and sets its Content-Type.
+func encodeResponse(res *response, codec ResponseCodec) error {
+	body, err := codec.Encode(res.body)
+	if err != nil {
+		return err
+	}
+
+	res.body = body
+	res.header.Set("Content-Type", codec.ContentType())
+	return nil
+}
+
+// accepts reports whether a request with header accepts responses of media
+// type mt. Requests without an Accept header accept any.
+func accepts(header http.Header, mt string) bool {
+	accept := header.Values("Accept")
+	if len(accept) == 0 {
+		return true
+	}
+
+	mt, _, err := mime.ParseMediaType(mt)
+	if err != nil {
+		return false
+	}
+	typ, _, _ := strings.Cut(mt, "/")
+
+	for _, value := range accept {
+		for _, r := range strings.Split(value, ",") {
+			rt, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+			if err != nil || params["q"] == "0" {
+				continue
+			}
+
+			if rt == mt || rt == "*/*" || rt == typ+"/*" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
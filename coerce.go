@@ -0,0 +1,146 @@
+package requestmigrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// FieldType is a JSON scalar type CoerceType converts fields between.
+type FieldType string
+
+const (
+	StringField FieldType = "string"
+	NumberField FieldType = "number"
+	BoolField   FieldType = "bool"
+)
+
+// CoercePolicy decides what CoerceType does with a value it can't convert,
+// e.g. a string that isn't a number.
+type CoercePolicy int
+
+const (
+	// CoerceFail fails the transform, and with it the migration.
+	CoerceFail CoercePolicy = iota
+	// CoerceKeep leaves the value as is.
+	CoerceKeep
+	// CoerceNull replaces the value with null.
+	CoerceNull
+)
+
+// CoerceType returns a transform converting the field name from the type
+// from to the type to, e.g. an ID served as a number by one version and as
+// a string by the next. Numbers are converted to their shortest decimal
+// form and back without going through a float, so large IDs keep their
+// precision; booleans convert to the numbers 1 and 0, and from 1 and 0 only.
+// Values that aren't of type from or can't be converted are handled
+// according to policy. Null values and bodies without name are left
+// untouched. Its inverse is CoerceType(name, to, from, ...).
+func CoerceType(name string, from, to FieldType, policy CoercePolicy) FieldTransform {
+	return func(m map[string]any) error {
+		v, ok := m[name]
+		if !ok || v == nil {
+			return nil
+		}
+
+		cv, err := coerce(v, from, to)
+		if err == nil {
+			m[name] = cv
+			return nil
+		}
+
+		switch policy {
+		case CoerceKeep:
+			return nil
+		case CoerceNull:
+			m[name] = nil
+			return nil
+		}
+
+		return fmt.Errorf("field %s: %w", name, err)
+	}
+}
+
+// coerce converts v from the type from to the type to.
+func coerce(v any, from, to FieldType) (any, error) {
+	s, err := scalarString(v, from)
+	if err != nil {
+		return nil, err
+	}
+
+	switch to {
+	case StringField:
+		return s, nil
+
+	case NumberField:
+		if from == BoolField {
+			if s == "true" {
+				return json.Number("1"), nil
+			}
+
+			return json.Number("0"), nil
+		}
+
+		if !isJSONNumber(s) {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+
+		return json.Number(s), nil
+
+	case BoolField:
+		if from == NumberField {
+			switch s {
+			case "0":
+				return false, nil
+			case "1":
+				return true, nil
+			}
+
+			return nil, fmt.Errorf("%s is not a boolean", s)
+		}
+
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", s)
+		}
+
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unknown field type %q", to)
+}
+
+// scalarString returns the text of v, which must be of type t.
+func scalarString(v any, t FieldType) (string, error) {
+	switch t {
+	case StringField:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+
+	case NumberField:
+		switch n := v.(type) {
+		case json.Number:
+			return n.String(), nil
+		case float64:
+			return strconv.FormatFloat(n, 'f', -1, 64), nil
+		}
+
+	case BoolField:
+		if b, ok := v.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+
+	default:
+		return "", fmt.Errorf("unknown field type %q", t)
+	}
+
+	return "", fmt.Errorf("value is not a %s", t)
+}
+
+// isJSONNumber reports whether s is a JSON number literal.
+func isJSONNumber(s string) bool {
+	var n json.Number
+	err := json.Unmarshal([]byte(s), &n)
+	return err == nil && n.String() == s
+}
@@ -0,0 +1,31 @@
+package requestmigrations
+
+import "net/url"
+
+// ConditionalMigration is implemented by migrations that only apply to some
+// requests, e.g. those to a given path and method. ShouldMigrateConstraint is
+// called before the migration runs, with the request's URL and method, the
+// body as it is at that step of the chain and whether the migration is
+// migrating a request, and the migration is skipped when it returns false.
+// Outside of Migrate, e.g. in Convert, the URL and method are empty.
+//
+// Since the body isn't known beforehand, Plan and WillMigrate list
+// conditional migrations as if they'd run.
+type ConditionalMigration interface {
+	ShouldMigrateConstraint(url *url.URL, method string, data []byte, isReq bool) bool
+}
+
+// shouldMigrate reports whether migration should run on data.
+func (m *migrator) shouldMigrate(migration Migration, direction Direction, data []byte) bool {
+	cm, ok := unwrapMigration(migration).(ConditionalMigration)
+	if !ok {
+		return true
+	}
+
+	u := m.url
+	if u == nil {
+		u = &url.URL{}
+	}
+
+	return cm.ShouldMigrateConstraint(u, m.method, data, direction == DirectionRequest)
+}
@@ -0,0 +1,88 @@
+package requestmigrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// constrainedMigration is a migration registered with RegisterConstraint.
+type constrainedMigration struct {
+	constraints *semver.Constraints
+	migration   Migration
+}
+
+// RegisterConstraint registers migration for clients whose version
+// satisfies constraint, e.g. ">=1.2.0 <2.0.0", rather than at a single
+// version. It runs once per payload, at the client's end of the chain: first
+// when a request is migrated and last when a response is migrated back.
+// Constraints are checked against the client's version when it's migrated,
+// so versions registered later are covered too. It's only valid for
+// SemverFormat versions.
+func (rm *RequestMigration) RegisterConstraint(constraint string, migration Migration) error {
+	if rm.opts.VersionFormat != SemverFormat && rm.opts.VersionFormatFunc == nil {
+		return fmt.Errorf("%w: constraints require semver versions", ErrInvalidVersionFormat)
+	}
+
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return fmt.Errorf("invalid constraint %s: %w", constraint, err)
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.constrained = append(rm.constrained, constrainedMigration{constraints: c, migration: migration})
+	return nil
+}
+
+// constrainedMigrations returns the migrations registered with
+// RegisterConstraint that apply to client.
+func (rm *RequestMigration) constrainedMigrations(client *Version) Migrations {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if len(rm.constrained) == 0 || client.Format != SemverFormat {
+		return nil
+	}
+
+	v, err := semver.NewVersion(client.String())
+	if err != nil {
+		return nil
+	}
+
+	var migrations Migrations
+	for _, cm := range rm.constrained {
+		if cm.constraints.Check(v) {
+			migrations = append(migrations, cm.migration)
+		}
+	}
+
+	return migrations
+}
+
+// constrainedStep returns the step running the handler's constrained
+// migration for direction, if any. It moves the payload within the client's
+// version.
+func (m *migrator) constrainedStep(ctx context.Context, handler string, direction Direction) (migrationStep, bool) {
+	if len(m.constrained) == 0 || len(m.versions) < 2 {
+		return migrationStep{}, false
+	}
+
+	migration := m.retrieveHandlerMigration(m.constrained, handler, direction)
+	if migration == nil || !m.isEnabled(ctx, migration) {
+		return migrationStep{}, false
+	}
+
+	if direction == DirectionResponse && !appliesToStatus(migration, m.status) {
+		return migrationStep{}, false
+	}
+
+	client := m.from
+	if m.ahead {
+		client = m.to
+	}
+
+	return migrationStep{from: client, to: client, migration: migration}, true
+}
@@ -0,0 +1,38 @@
+package requestmigrations
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// isMigratable reports whether a payload with header and body should be
+// migrated. Without MigratableContentTypes only JSON payloads are, otherwise
+// only those whose media type is listed; an entry like "+json" matches every
+// media type with that suffix. Payloads without a Content-Type are treated as
+// application/json when they're valid JSON.
+func (rm *RequestMigration) isMigratable(header http.Header, body []byte) bool {
+	if len(rm.opts.MigratableContentTypes) == 0 {
+		return isJSONContent(header, body)
+	}
+
+	mt := "application/json"
+	if ct := header.Get("Content-Type"); !isStringEmpty(ct) {
+		var ok bool
+		mt, ok = baseMediaType(ct)
+		if !ok {
+			return false
+		}
+	} else if !json.Valid(body) {
+		return false
+	}
+
+	for _, allowed := range rm.opts.MigratableContentTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if mt == allowed || (strings.HasPrefix(allowed, "+") && strings.HasSuffix(mt, allowed)) {
+			return true
+		}
+	}
+
+	return false
+}
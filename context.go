@@ -0,0 +1,101 @@
+package requestmigrations
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	migratedKey  contextKey = "migrated"
+	stepCountKey contextKey = "stepCount"
+	canaryKey    contextKey = "canary"
+	fieldsKey    contextKey = "selectedFields"
+	disabledKey  contextKey = "disabledMigrations"
+	hooksKey     contextKey = "hooksRan"
+)
+
+// StepCount returns the number of versions a request was migrated across,
+// i.e. the length of its migration chain. It's zero for requests that weren't
+// migrated. Since the migrated request's context is updated in place, it can
+// be read by middlewares wrapping the handler after the handler returns.
+func StepCount(ctx context.Context) int {
+	steps, _ := ctx.Value(stepCountKey).(int)
+	return steps
+}
+
+// WithSelectedFields returns a copy of ctx carrying the fields a client
+// selected, e.g. from a fields query parameter. It's opt-in: set it on the
+// request's context before calling Migrate, and migrations implementing
+// ContextMigration can call FieldSelected to skip work on fields the client
+// won't receive.
+func WithSelectedFields(ctx context.Context, fields []string) context.Context {
+	return context.WithValue(ctx, fieldsKey, fields)
+}
+
+// SelectedFields returns the fields set with WithSelectedFields, or nil when
+// the client didn't select any.
+func SelectedFields(ctx context.Context) []string {
+	fields, _ := ctx.Value(fieldsKey).([]string)
+	return fields
+}
+
+// FieldSelected reports whether the client selected field. Every field is
+// selected when no selection was set on ctx.
+func FieldSelected(ctx context.Context, field string) bool {
+	fields, ok := ctx.Value(fieldsKey).([]string)
+	if !ok {
+		return true
+	}
+
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setContextValue updates the request's context in place so the caller's
+// pointer observes the new value.
+func setContextValue(r *http.Request, key contextKey, val interface{}) {
+	*r = *r.WithContext(context.WithValue(r.Context(), key, val))
+}
+
+// markMigrated records on the request's context that its body has been
+// migrated.
+func markMigrated(r *http.Request) {
+	setContextValue(r, migratedKey, true)
+}
+
+func isMigrated(r *http.Request) bool {
+	migrated, _ := r.Context().Value(migratedKey).(bool)
+	return migrated
+}
+
+// WithDisabledMigrations returns a copy of ctx with the migrations named
+// names, i.e. their type names or the names RegisterFunc gave them, disabled,
+// e.g. to bisect which migration breaks a payload. Requests whose context
+// carries it skip those migrations, along with any disabled by a parent
+// context.
+func (rm *RequestMigration) WithDisabledMigrations(ctx context.Context, names ...string) context.Context {
+	parent := disabledMigrations(ctx)
+
+	disabled := make(map[string]struct{}, len(parent)+len(names))
+	for name := range parent {
+		disabled[name] = struct{}{}
+	}
+
+	for _, name := range names {
+		disabled[name] = struct{}{}
+	}
+
+	return context.WithValue(ctx, disabledKey, disabled)
+}
+
+func disabledMigrations(ctx context.Context) map[string]struct{} {
+	disabled, _ := ctx.Value(disabledKey).(map[string]struct{})
+	return disabled
+}
@@ -0,0 +1,140 @@
+package requestmigrations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Convert migrates body between two registered versions, neither of which
+// needs to be the current version. When from is older than to, the handler's
+// request migrations are applied forward; when it's newer, the handler's
+// response migrations are applied backward.
+func (rm *RequestMigration) Convert(from, to string, handler string, body []byte) ([]byte, error) {
+	fi, ti := rm.versionIndex(from), rm.versionIndex(to)
+	if fi < 0 || ti < 0 {
+		return nil, ErrInvalidVersion
+	}
+
+	fv := rm.newVersion(from)
+	tv := rm.newVersion(to)
+
+	switch {
+	case fi < ti:
+		m, err := rm.newMigrator(fv, tv)
+		if err != nil {
+			return nil, err
+		}
+
+		data, _, err := m.applyRequestMigrations(context.Background(), body, http.Header{}, handler)
+		return data, err
+
+	case fi > ti:
+		// response migrations run from the migrator's to back to its from.
+		m, err := rm.newMigrator(tv, fv)
+		if err != nil {
+			return nil, err
+		}
+
+		data, _, err := m.applyResponseMigrations(context.Background(), body, http.Header{}, handler)
+		return data, err
+
+	default:
+		return body, nil
+	}
+}
+
+// MigrateFrame migrates a message frame, e.g. a WebSocket message, for a
+// client on version. Inbound frames (DirectionRequest) are migrated forward to
+// the current version with handler's request migrations, and outbound frames
+// (DirectionResponse) back to version with its response migrations.
+//
+// MigrateFrame is safe for concurrent use, but each frame is migrated
+// independently: callers that need frames delivered in order should migrate
+// them on the goroutine that reads or writes the connection.
+func (rm *RequestMigration) MigrateFrame(version, handler string, direction Direction, frame []byte) ([]byte, error) {
+	current := rm.getCurrentVersion().String()
+
+	switch direction {
+	case DirectionRequest:
+		return rm.Convert(version, current, handler, frame)
+	case DirectionResponse:
+		return rm.Convert(current, version, handler, frame)
+	default:
+		return nil, fmt.Errorf("unknown direction %q", direction)
+	}
+}
+
+// MigrateHTTPResponse migrates the body of resp, e.g. one received by a
+// client SDK or a reverse proxy, from the version it was served in to the
+// version to with handler's migrations. The served version is read from
+// VersionHeader, and assumed to be the current version when resp doesn't
+// have it. resp.Body is replaced with the migrated body, and its
+// Content-Length and VersionHeader are updated to match. Bodies that aren't
+// migratable, see MigratableContentTypes, are left untouched. On error,
+// resp.Body is restored so it can still be read.
+func (rm *RequestMigration) MigrateHTTPResponse(resp *http.Response, handler, to string) error {
+	from := rm.getCurrentVersion().String()
+	if v := resp.Header.Get(rm.opts.VersionHeader); !isStringEmpty(rm.opts.VersionHeader) && !isStringEmpty(v) {
+		from = v
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if len(body) == 0 || !rm.isMigratable(resp.Header, body) {
+		return nil
+	}
+
+	data, err := rm.Convert(from, to, handler, body)
+	if err != nil {
+		return err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	if !isStringEmpty(rm.opts.VersionHeader) {
+		resp.Header.Set(rm.opts.VersionHeader, to)
+	}
+
+	return nil
+}
+
+// versionIndex returns the position of version in the sorted registered
+// versions, or -1 if it isn't registered.
+func (rm *RequestMigration) versionIndex(version string) int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.indexOf(version)
+}
+
+// indexOf is versionIndex for callers already holding rm.mu. Versions are
+// looked up by their ordinal, and only parsed when they're spelt differently
+// from the registered version, e.g. "2" for "v2".
+func (rm *RequestMigration) indexOf(version string) int {
+	if i, ok := rm.ordinals[version]; ok {
+		return i
+	}
+
+	v := rm.newVersion(version)
+	if !v.IsValid() {
+		return -1
+	}
+
+	for i, vv := range rm.versions {
+		if vv.Equal(v) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,151 @@
+package requestmigrations
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// DirectionalMigration is implemented by migrations that transform both a
+// handler's requests and its responses. MigrateRequest migrates a request
+// from the previous version to this one and MigrateResponse migrates a
+// response back again, so the two transformations are kept together and
+// can't drift apart. Since the direction is explicit, the type name only has
+// to start with the handler's name, e.g. createUserSplitNameMigration.
+//
+// Types that don't also implement Migration can be registered with
+// Directional.
+type DirectionalMigration interface {
+	MigrateRequest(data []byte, header http.Header) ([]byte, http.Header, error)
+	MigrateResponse(data []byte, header http.Header) ([]byte, http.Header, error)
+}
+
+// Directional adapts m so it can be registered alongside other migrations.
+// Calling Migrate on the result migrates a request.
+func Directional(m DirectionalMigration) Migration {
+	return &directionalMigration{m}
+}
+
+type directionalMigration struct {
+	DirectionalMigration
+}
+
+func (d *directionalMigration) Migrate(data []byte, header http.Header) ([]byte, http.Header, error) {
+	return d.MigrateRequest(data, header)
+}
+
+// asDirectional reports whether migration transforms requests and responses
+// through explicit methods.
+func asDirectional(migration Migration) (DirectionalMigration, bool) {
+	dm, ok := unwrapMigration(migration).(DirectionalMigration)
+	return dm, ok
+}
+
+// unwrapMigration returns the value migration was created from, so that
+// adapted migrations are named and matched by their own type.
+func unwrapMigration(migration Migration) any {
+	switch m := migration.(type) {
+	case *directionalMigration:
+		return m.DirectionalMigration
+	case *headerMigration:
+		return m.HeaderMigration
+	}
+
+	return migration
+}
+
+// MigrateFunc is the signature of Migration.Migrate.
+type MigrateFunc func(data []byte, header http.Header) ([]byte, http.Header, error)
+
+// RegisterFunc registers a migration for handler in version made of two
+// functions: forward migrates requests from the previous version to this one
+// and backward migrates responses back again. Either may be nil to leave
+// that direction untouched. The version is registered if it isn't already.
+// Only one migration per version runs for a handler, so ErrMigrationConflict
+// is returned if the version already has a migration for handler.
+// The migration is named {handler}Func@{version}, e.g.
+// createUserFunc@2023-03-01, which is the name FeatureGate,
+// WithDisabledMigrations, audit entries and errors refer to it by.
+func (rm *RequestMigration) RegisterFunc(version, handler string, forward, backward MigrateFunc) error {
+	migration := newFuncMigration(version, handler, forward, backward)
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	err := rm.checkFuncConflict(version, handler)
+	if err != nil {
+		return err
+	}
+
+	return rm.addMigrations(MigrationStore{version: Migrations{migration}}, true)
+}
+
+// checkFuncConflict returns ErrMigrationConflict if version already has a
+// migration for handler in either direction, which would shadow a function
+// migration registered after it. rm.mu must be held.
+func (rm *RequestMigration) checkFuncConflict(version, handler string) error {
+	v, err := NewVersion(rm.versionFormat(version), version)
+	if err != nil {
+		// addMigrations reports invalid versions.
+		return nil
+	}
+
+	m := &migrator{}
+	existing := rm.migrations[v.String()]
+	for _, direction := range []Direction{DirectionRequest, DirectionResponse} {
+		if migration := m.retrieveHandlerMigration(existing, handler, direction); migration != nil {
+			return fmt.Errorf("%w: %s has %s for %s", ErrMigrationConflict, version, migrationName(migration), handler)
+		}
+	}
+
+	return nil
+}
+
+// newFuncMigration returns the migration RegisterFunc registers.
+func newFuncMigration(version, handler string, forward, backward MigrateFunc) Migration {
+	return Directional(&funcMigration{
+		name:     handler + "Func@" + version,
+		handler:  handler,
+		pattern:  regexp.MustCompile("(?i)^" + regexp.QuoteMeta(handler) + "$"),
+		forward:  forward,
+		backward: backward,
+	})
+}
+
+// funcMigration is the migration built by RegisterFunc. It matches its
+// handler by pattern, since its type name doesn't identify it.
+type funcMigration struct {
+	name     string
+	handler  string
+	pattern  *regexp.Regexp
+	forward  MigrateFunc
+	backward MigrateFunc
+}
+
+func (f *funcMigration) MigrateRequest(data []byte, header http.Header) ([]byte, http.Header, error) {
+	if f.forward == nil {
+		return data, header, nil
+	}
+
+	return f.forward(data, header)
+}
+
+func (f *funcMigration) MigrateResponse(data []byte, header http.Header) ([]byte, http.Header, error) {
+	if f.backward == nil {
+		return data, header, nil
+	}
+
+	return f.backward(data, header)
+}
+
+func (f *funcMigration) migrationName() string {
+	return f.name
+}
+
+func (f *funcMigration) HandlerPattern() *regexp.Regexp {
+	return f.pattern
+}
+
+func (f *funcMigration) Description() string {
+	return "function migration for " + f.handler
+}
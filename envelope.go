@@ -0,0 +1,177 @@
+package requestmigrations
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidEnvelope    = errors.New("invalid envelope")
+	ErrCompressedEnvelope = errors.New("compressed envelopes are not supported")
+	ErrNoMessage          = errors.New("envelope carries no message")
+)
+
+// EnvelopeCodec unwraps the message carried in a framed payload before it's
+// migrated and wraps the migrated message back afterwards, so migrations only
+// ever see the bare message.
+type EnvelopeCodec interface {
+	// Unwrap returns the message carried by data. It returns ErrNoMessage
+	// when data legitimately carries nothing to migrate, e.g. an error
+	// response, in which case data is passed through untouched.
+	Unwrap(data []byte) ([]byte, error)
+
+	// Wrap returns original with its message replaced by message.
+	Wrap(original, message []byte) ([]byte, error)
+}
+
+const connectPrefixLength = 5
+
+const (
+	connectFlagCompressed = 0b00000001
+	connectFlagEndStream  = 0b00000010
+)
+
+// ConnectEnvelopeCodec implements EnvelopeCodec for Connect's streaming
+// framing: a sequence of frames, each a one byte flags field and a four byte
+// big-endian message length followed by the message. The message frame is
+// migrated and end-stream frames, e.g. the one trailing a streaming
+// response, are passed through untouched. Payloads holding more than one
+// message frame or a compressed message aren't supported.
+type ConnectEnvelopeCodec struct{}
+
+func (ConnectEnvelopeCodec) Unwrap(data []byte) ([]byte, error) {
+	frames, i, err := connectFrames(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return frames[i][connectPrefixLength:], nil
+}
+
+func (ConnectEnvelopeCodec) Wrap(original, message []byte) ([]byte, error) {
+	frames, i, err := connectFrames(original)
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(original) - len(frames[i]) + connectPrefixLength + len(message)
+	data := make([]byte, 0, size)
+	for j, frame := range frames {
+		if j != i {
+			data = append(data, frame...)
+			continue
+		}
+
+		data = append(data, frame[0], 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], uint32(len(message)))
+		data = append(data, message...)
+	}
+
+	return data, nil
+}
+
+// connectFrames splits data into its frames, prefixes included, and returns
+// them along with the index of the message frame.
+func connectFrames(data []byte) ([][]byte, int, error) {
+	var frames [][]byte
+	message := -1
+	for len(data) > 0 {
+		if len(data) < connectPrefixLength {
+			return nil, 0, ErrInvalidEnvelope
+		}
+
+		size := binary.BigEndian.Uint32(data[1:connectPrefixLength])
+		if uint64(size) > uint64(len(data)-connectPrefixLength) {
+			return nil, 0, ErrInvalidEnvelope
+		}
+
+		frame := data[:connectPrefixLength+int(size)]
+		data = data[len(frame):]
+
+		if frame[0]&connectFlagEndStream == 0 {
+			if message != -1 {
+				return nil, 0, ErrInvalidEnvelope
+			}
+
+			if frame[0]&connectFlagCompressed != 0 {
+				return nil, 0, ErrCompressedEnvelope
+			}
+
+			message = len(frames)
+		}
+
+		frames = append(frames, frame)
+	}
+
+	if len(frames) == 0 {
+		return nil, 0, ErrInvalidEnvelope
+	}
+
+	if message == -1 {
+		return nil, 0, ErrNoMessage
+	}
+
+	return frames, message, nil
+}
+
+// JSONPathEnvelopeCodec implements EnvelopeCodec for JSON payloads nesting
+// their message under Path, a dot separated list of keys, e.g. "data" for
+// {"status":true,"message":"...","data":{...}}. Payloads without a message at
+// Path are passed through untouched.
+type JSONPathEnvelopeCodec struct {
+	Path string
+}
+
+func (c JSONPathEnvelopeCodec) Unwrap(data []byte) ([]byte, error) {
+	message := json.RawMessage(data)
+	for _, key := range c.keys() {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(message, &obj); err != nil || obj == nil {
+			return nil, ErrNoMessage
+		}
+
+		var ok bool
+		message, ok = obj[key]
+		if !ok {
+			return nil, ErrNoMessage
+		}
+	}
+
+	if bytes.Equal(bytes.TrimSpace(message), []byte("null")) {
+		return nil, ErrNoMessage
+	}
+
+	return message, nil
+}
+
+func (c JSONPathEnvelopeCodec) Wrap(original, message []byte) ([]byte, error) {
+	return setJSONPath(original, c.keys(), message)
+}
+
+func (c JSONPathEnvelopeCodec) keys() []string {
+	return strings.Split(c.Path, ".")
+}
+
+// setJSONPath returns data with the value at keys replaced by value, leaving
+// every other key as is.
+func setJSONPath(data []byte, keys []string, value []byte) ([]byte, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+
+	v, err := setJSONPath(obj[keys[0]], keys[1:], value)
+	if err != nil {
+		return nil, err
+	}
+
+	obj[keys[0]] = v
+	return json.Marshal(obj)
+}
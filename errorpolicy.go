@@ -0,0 +1,61 @@
+package requestmigrations
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// MigrationErrorPolicy decides what happens to a request or response whose
+// migration fails, including when its version isn't registered.
+type MigrationErrorPolicy int
+
+const (
+	// FailClosed returns the error from Migrate for requests, and writes a
+	// 500 for responses. It's the default.
+	FailClosed MigrationErrorPolicy = iota
+
+	// FailOpen serves the request or response un-migrated.
+	FailOpen
+
+	// Passthrough logs the error and serves the request or response
+	// un-migrated.
+	Passthrough
+)
+
+// handleMigrationError applies the OnMigrationError policy to err, returning
+// nil if the payload should be served un-migrated.
+func (rm *RequestMigration) handleMigrationError(r *http.Request, handler string, direction Direction, err error) error {
+	var he *hookError
+	if errors.As(err, &he) {
+		return he.err
+	}
+
+	switch rm.opts.OnMigrationError {
+	case FailOpen:
+		return nil
+
+	case Passthrough:
+		log.Printf("requestmigrations: %s migration failed for %s %s on handler %s, continuing un-migrated: %v",
+			direction, r.Method, r.URL.Path, handler, err)
+		return nil
+	}
+
+	return err
+}
+
+// restoreBody puts a copy of the bytes read into buf back in front of what's
+// left of r's body, so a request whose migration failed can be read as it was
+// sent, whether it's served or handed to an error handler.
+func restoreBody(r *http.Request, buf *bytes.Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(bytes.Clone(buf.Bytes())), r.Body), r.Body}
+}
@@ -0,0 +1,62 @@
+package requestmigrations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// refreshETag updates the ETag of a response whose body was changed by its
+// migrations, since the one set by the handler describes the current version
+// body. With RecomputeETag the ETag is recomputed over the migrated body,
+// otherwise it's removed. It reports whether the recomputed ETag matches the
+// request's If-None-Match, i.e. the client's copy is still fresh.
+func (rm *RequestMigration) refreshETag(r *http.Request, res *response) bool {
+	etag := res.header.Get("ETag")
+	if etag == "" {
+		return false
+	}
+
+	if !rm.opts.RecomputeETag {
+		res.header.Del("ETag")
+		return false
+	}
+
+	sum := sha256.Sum256(res.body)
+	etag = weakPrefix(etag) + `"` + hex.EncodeToString(sum[:16]) + `"`
+	res.header.Set("ETag", etag)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	return etagMatches(r.Header.Get("If-None-Match"), etag)
+}
+
+// weakPrefix returns the weak validator prefix of etag, if any, so
+// recomputed ETags stay as weak as the handler's.
+func weakPrefix(etag string) string {
+	if strings.HasPrefix(etag, "W/") {
+		return "W/"
+	}
+
+	return ""
+}
+
+// etagMatches reports whether etag matches the If-None-Match header value,
+// using weak comparison as RFC 9110 requires for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
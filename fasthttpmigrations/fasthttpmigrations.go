@@ -0,0 +1,153 @@
+// Package fasthttpmigrations adapts requestmigrations to handlers built on
+// github.com/valyala/fasthttp.
+package fasthttpmigrations
+
+import (
+	"io"
+	"net/http"
+
+	rms "github.com/subomi/requestmigrations"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// Migrator bridges a fasthttp.RequestCtx to the net/http based migration
+// pipeline of a RequestMigration.
+type Migrator struct {
+	rm *rms.RequestMigration
+}
+
+func New(rm *rms.RequestMigration) *Migrator {
+	return &Migrator{rm: rm}
+}
+
+// Migrate is the fasthttp counterpart of RequestMigration.Migrate. It should
+// be called at the start of your handler to transform the request body. The
+// returned rollback function should be deferred, it migrates whatever the
+// handler wrote to ctx.Response back to the user's version.
+func (m *Migrator) Migrate(ctx *fasthttp.RequestCtx, handler string) (error, func()) {
+	r := &http.Request{}
+	err := fasthttpadaptor.ConvertRequest(ctx, r, true)
+	if err != nil {
+		return err, nil
+	}
+
+	// ConvertRequest aliases the header values to fasthttp's buffers, which
+	// we're about to overwrite, so use our own copy.
+	r.Header = toHTTPHeader(&ctx.Request.Header)
+
+	err, res, rollback := m.rm.Migrate(r, handler)
+	if err != nil {
+		return err, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err, nil
+	}
+
+	ctx.Request.SetBody(body)
+	setRequestHeader(&ctx.Request.Header, r.Header)
+
+	return nil, func() {
+		res.Write(append([]byte(nil), ctx.Response.Body()...))
+		res.SetHeader(ctx.Response.StatusCode())
+		rollback(newResponseWriter(ctx))
+	}
+}
+
+func toHTTPHeader(rh *fasthttp.RequestHeader) http.Header {
+	header := make(http.Header)
+	rh.VisitAll(func(k, v []byte) {
+		header.Add(string(k), string(v))
+	})
+
+	return header
+}
+
+func setRequestHeader(rh *fasthttp.RequestHeader, header http.Header) {
+	var stale []string
+	rh.VisitAll(func(k, _ []byte) {
+		if _, ok := header[http.CanonicalHeaderKey(string(k))]; !ok {
+			stale = append(stale, string(k))
+		}
+	})
+
+	for _, k := range stale {
+		rh.Del(k)
+	}
+
+	for k, vs := range header {
+		rh.Del(k)
+		for _, v := range vs {
+			rh.Add(k, v)
+		}
+	}
+}
+
+// responseWriter is a minimal http.ResponseWriter writing into a fasthttp
+// response.
+type responseWriter struct {
+	ctx    *fasthttp.RequestCtx
+	header http.Header
+}
+
+// newResponseWriter returns a responseWriter whose header starts with the
+// headers the handler set on ctx.Response, so response migrations see them.
+// Content-Length is left out, fasthttp sets it from the body it writes.
+func newResponseWriter(ctx *fasthttp.RequestCtx) *responseWriter {
+	// a copy, so the default Content-Type fasthttp reports for responses
+	// without one isn't mistaken for the handler's.
+	var rh fasthttp.ResponseHeader
+	ctx.Response.Header.CopyTo(&rh)
+	rh.SetNoDefaultContentType(true)
+
+	header := make(http.Header)
+	rh.VisitAll(func(k, v []byte) {
+		key := string(k)
+		if key != fasthttp.HeaderContentLength {
+			header.Add(key, string(v))
+		}
+	})
+
+	return &responseWriter{ctx: ctx, header: header}
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader also drops the body the handler set, it's the current version
+// body and responses that fail to migrate are sent without one.
+func (w *responseWriter) WriteHeader(statusCode int) {
+	w.flushHeader()
+	w.ctx.SetStatusCode(statusCode)
+	w.ctx.Response.ResetBody()
+}
+
+func (w *responseWriter) Write(body []byte) (int, error) {
+	w.flushHeader()
+	w.ctx.Response.SetBody(body)
+	return len(body), nil
+}
+
+func (w *responseWriter) flushHeader() {
+	var stale []string
+	w.ctx.Response.Header.VisitAll(func(k, _ []byte) {
+		key := string(k)
+		if _, ok := w.header[key]; !ok && key != fasthttp.HeaderContentLength {
+			stale = append(stale, key)
+		}
+	})
+
+	for _, k := range stale {
+		w.ctx.Response.Header.Del(k)
+	}
+
+	for k, vs := range w.header {
+		w.ctx.Response.Header.Del(k)
+		for _, v := range vs {
+			w.ctx.Response.Header.Add(k, v)
+		}
+	}
+}
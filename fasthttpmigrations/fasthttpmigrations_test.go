@@ -0,0 +1,194 @@
+package fasthttpmigrations
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rms "github.com/subomi/requestmigrations"
+	"github.com/valyala/fasthttp"
+)
+
+type user struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type oldUser struct {
+	Email    string `json:"email"`
+	FullName string `json:"full_name"`
+}
+
+type createUserRequestSplitNameMigration struct{}
+
+func (c *createUserRequestSplitNameMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	var oUser oldUser
+	err := json.Unmarshal(body, &oUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	splitName := strings.Split(oUser.FullName, " ")
+	body, err = json.Marshal(&user{
+		Email:     oUser.Email,
+		FirstName: splitName[0],
+		LastName:  splitName[1],
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, h, nil
+}
+
+type createUserResponseCombineNamesMigration struct{}
+
+func (c *createUserResponseCombineNamesMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	var nUser user
+	err := json.Unmarshal(body, &nUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err = json.Marshal(&oldUser{
+		Email:    nUser.Email,
+		FullName: strings.Join([]string{nUser.FirstName, nUser.LastName}, " "),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, h, nil
+}
+
+type getUserResponseSourceMigration struct{}
+
+func (g *getUserResponseSourceMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	body, err := json.Marshal(map[string]string{"source": h.Get("X-Source")})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, h, nil
+}
+
+type deleteUserResponseFailingMigration struct{}
+
+func (d *deleteUserResponseFailingMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	return nil, nil, errors.New("cannot migrate response")
+}
+
+func newMigrator(t *testing.T) *Migrator {
+	rm, err := rms.NewRequestMigration(&rms.RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  rms.DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(rms.MigrationStore{
+		"2023-03-01": rms.Migrations{
+			&createUserRequestSplitNameMigration{},
+			&createUserResponseCombineNamesMigration{},
+			&getUserResponseSourceMigration{},
+			&deleteUserResponseFailingMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	return New(rm)
+}
+
+func createUser(t *testing.T, m *Migrator) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		err, rollback := m.Migrate(ctx, "createUser")
+		require.NoError(t, err)
+		defer rollback()
+
+		var u user
+		err = json.Unmarshal(ctx.PostBody(), &u)
+		require.NoError(t, err)
+		require.Equal(t, "Convoy", u.FirstName)
+		require.Equal(t, "Engineering", u.LastName)
+
+		body, err := json.Marshal(&u)
+		require.NoError(t, err)
+
+		ctx.SetStatusCode(fasthttp.StatusCreated)
+		ctx.SetBody(body)
+	}
+}
+
+func Test_Migrate(t *testing.T) {
+	m := newMigrator(t)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/users")
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetBody([]byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`))
+
+	createUser(t, m)(&ctx)
+
+	var u oldUser
+	err := json.Unmarshal(ctx.Response.Body(), &u)
+	require.NoError(t, err)
+	require.Equal(t, "Convoy Engineering", u.FullName)
+	require.Equal(t, fasthttp.StatusCreated, ctx.Response.StatusCode())
+}
+
+func Test_Migrate_ResponseHeader(t *testing.T) {
+	m := newMigrator(t)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/users/1")
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+
+	func() {
+		err, rollback := m.Migrate(&ctx, "getUser")
+		require.NoError(t, err)
+		defer rollback()
+
+		ctx.Response.Header.SetContentType("application/json")
+		ctx.Response.Header.Set("X-Source", "cache")
+		ctx.SetBody([]byte(`{"id":1}`))
+	}()
+
+	require.JSONEq(t, `{"source":"cache"}`, string(ctx.Response.Body()))
+	require.Equal(t, "application/json", string(ctx.Response.Header.ContentType()))
+	require.Equal(t, "cache", string(ctx.Response.Header.Peek("X-Source")))
+}
+
+func Test_Migrate_ResponseMigrationFails(t *testing.T) {
+	m := newMigrator(t)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/users/1")
+	ctx.Request.Header.SetMethod(fasthttp.MethodDelete)
+
+	func() {
+		err, rollback := m.Migrate(&ctx, "deleteUser")
+		require.NoError(t, err)
+		defer rollback()
+
+		ctx.SetBody([]byte(`{"id":1}`))
+	}()
+
+	require.Equal(t, fasthttp.StatusInternalServerError, ctx.Response.StatusCode())
+	require.Empty(t, ctx.Response.Body())
+}
@@ -0,0 +1,316 @@
+package requestmigrations
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FieldState reports whether the field name is present in m and, if so,
+// whether it's explicitly null. It's meant for migrations that decode bodies
+// into a map[string]any and must tell {"field": null} apart from a missing
+// field, e.g. to decide whether to backfill it.
+//
+// encoding/json keeps the distinction through a map round trip: an explicit
+// null is decoded to a present nil value and encoded back to null, while a
+// missing field stays missing.
+func FieldState(m map[string]any, name string) (present bool, isNull bool) {
+	v, ok := m[name]
+	if !ok {
+		return false, false
+	}
+
+	return true, v == nil
+}
+
+// DeepMerge copies the fields of src into dst. Where both have an object for
+// the same field, the objects are merged recursively instead of dst's being
+// replaced, so a backward migration can rebuild an older object from several
+// newer fields one part at a time, e.g. merging {"address":{"geo":{"lat":1}}}
+// into {"address":{"city":"Lagos","geo":{"lng":2}}} keeps city and lng. Any
+// other value in src, including null and arrays, overwrites dst's.
+func DeepMerge(dst, src map[string]any) {
+	for k, v := range src {
+		sv, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		dv, ok := dst[k].(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		DeepMerge(dv, sv)
+	}
+}
+
+// FieldTransform changes the fields of a body decoded into a map[string]any.
+// Transforms are composed with ApplyFieldTransforms.
+type FieldTransform func(m map[string]any) error
+
+// ApplyFieldTransforms decodes the JSON object data, applies transforms to it
+// in order and encodes the result. Numbers are decoded as json.Number, so
+// integers beyond 2^53, e.g. IDs, keep their precision. It lets a migration
+// be written as a list of field changes, e.g.
+//
+//	func (c *getUserResponseSplitAddressMigration) Migrate(data []byte, h http.Header) ([]byte, http.Header, error) {
+//		data, err := rms.ApplyFieldTransforms(data, rms.JoinFields([]string{"street", "city", "zip"}, "address", join))
+//		return data, h, err
+//	}
+func ApplyFieldTransforms(data []byte, transforms ...FieldTransform) ([]byte, error) {
+	var m map[string]any
+	err := decodeJSON(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, transform := range transforms {
+		err = transform(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(m)
+}
+
+// decodeJSON decodes the single JSON value data into v like json.Unmarshal,
+// except numbers are decoded as json.Number.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = dec.Token()
+	if err != io.EOF {
+		return errors.New("invalid data after top-level JSON value")
+	}
+
+	return nil
+}
+
+// SplitField returns a transform replacing the string field src with the
+// fields into, set to the parts splitFn returns in order. splitFn must return
+// exactly one part per field. A null src sets every field to null, and bodies
+// without src are left untouched. Its inverse is JoinFields(into, src, ...).
+func SplitField(src string, into []string, splitFn func(string) []string) FieldTransform {
+	return func(m map[string]any) error {
+		v, ok := m[src]
+		if !ok {
+			return nil
+		}
+
+		delete(m, src)
+		if v == nil {
+			for _, name := range into {
+				m[name] = nil
+			}
+
+			return nil
+		}
+
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("field %s is not a string", src)
+		}
+
+		parts := splitFn(s)
+		if len(parts) != len(into) {
+			return fmt.Errorf("field %s split into %d parts, expected %d", src, len(parts), len(into))
+		}
+
+		for i, name := range into {
+			m[name] = parts[i]
+		}
+
+		return nil
+	}
+}
+
+// JoinFields returns a transform replacing the string fields srcs with the
+// field into, set to what joinFn returns for their values in order. Missing
+// fields are passed to joinFn as empty strings, and when every field is null
+// into is set to null. Bodies without any of srcs are left untouched. Its
+// inverse is SplitField(into, srcs, ...).
+func JoinFields(srcs []string, into string, joinFn func([]string) string) FieldTransform {
+	return func(m map[string]any) error {
+		parts := make([]string, len(srcs))
+
+		var present, null int
+		for i, name := range srcs {
+			v, ok := m[name]
+			if !ok {
+				continue
+			}
+
+			present++
+			if v == nil {
+				null++
+				continue
+			}
+
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("field %s is not a string", name)
+			}
+
+			parts[i] = s
+		}
+
+		if present == 0 {
+			return nil
+		}
+
+		for _, name := range srcs {
+			delete(m, name)
+		}
+
+		if null == len(srcs) {
+			m[into] = nil
+			return nil
+		}
+
+		m[into] = joinFn(parts)
+		return nil
+	}
+}
+
+// RenameField returns a transform renaming the field from to to, replacing
+// any value to already has. Bodies without from are left untouched. Its
+// inverse is RenameField(to, from).
+func RenameField(from, to string) FieldTransform {
+	return func(m map[string]any) error {
+		v, ok := m[from]
+		if !ok {
+			return nil
+		}
+
+		delete(m, from)
+		m[to] = v
+		return nil
+	}
+}
+
+// DropField returns a transform removing the field name. Its inverse is
+// AddField(name, ...), which can only restore a default value.
+func DropField(name string) FieldTransform {
+	return func(m map[string]any) error {
+		delete(m, name)
+		return nil
+	}
+}
+
+// AddField returns a transform setting the field name to value, replacing
+// any value it already has. Its inverse is DropField(name).
+func AddField(name string, value any) FieldTransform {
+	return func(m map[string]any) error {
+		m[name] = value
+		return nil
+	}
+}
+
+// DefaultField returns a transform backfilling the field name with value in
+// bodies without it, e.g. for a field that became required, while existing
+// values, including null, are kept. Its inverse is DropField(name), or no
+// transform at all where older clients can be sent the field.
+func DefaultField(name string, value any) FieldTransform {
+	return func(m map[string]any) error {
+		if present, _ := FieldState(m, name); !present {
+			m[name] = value
+		}
+
+		return nil
+	}
+}
+
+// MoveField returns a transform moving the value at the RFC 6901 JSON
+// Pointer src to the pointer dst, e.g. /address/city to /city, replacing any
+// value at dst. Both pointers must only go through objects. Objects missing
+// on the way to dst are created and objects left empty on the way to src are
+// removed, so its inverse is MoveField(dst, src). Bodies without src are left
+// untouched.
+func MoveField(src, dst string) FieldTransform {
+	return func(m map[string]any) error {
+		from, err := parsePointer(src)
+		if err != nil {
+			return err
+		}
+
+		to, err := parsePointer(dst)
+		if err != nil {
+			return err
+		}
+
+		parent, ok := objectAt(m, from[:len(from)-1], false)
+		if !ok {
+			return nil
+		}
+
+		name := from[len(from)-1]
+		v, ok := parent[name]
+		if !ok {
+			return nil
+		}
+
+		delete(parent, name)
+		pruneObjects(m, from[:len(from)-1])
+
+		parent, ok = objectAt(m, to[:len(to)-1], true)
+		if !ok {
+			return fmt.Errorf("pointer %s: parent is not an object", dst)
+		}
+
+		parent[to[len(to)-1]] = v
+		return nil
+	}
+}
+
+// objectAt returns the object at tokens in m. When create is set, missing
+// objects are created on the way.
+func objectAt(m map[string]any, tokens []string, create bool) (map[string]any, bool) {
+	for _, token := range tokens {
+		v, ok := m[token]
+		if !ok && create {
+			child := make(map[string]any)
+			m[token] = child
+			m = child
+			continue
+		}
+
+		child, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		m = child
+	}
+
+	return m, true
+}
+
+// pruneObjects removes the objects at tokens in m, deepest first, for as
+// long as they're empty.
+func pruneObjects(m map[string]any, tokens []string) {
+	for i := len(tokens); i > 0; i-- {
+		parent, ok := objectAt(m, tokens[:i-1], false)
+		if !ok {
+			return
+		}
+
+		child, ok := parent[tokens[i-1]].(map[string]any)
+		if !ok || len(child) > 0 {
+			return
+		}
+
+		delete(parent, tokens[i-1])
+	}
+}
@@ -0,0 +1,211 @@
+package requestmigrations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// maxFormMemory is the number of bytes of a multipart form held in memory,
+// the rest of its files are stored on disk. It matches net/http's default.
+const maxFormMemory = 32 << 20
+
+// FormMigration is implemented by request migrations that transform
+// multipart/form-data bodies. For such bodies, MigrateForm is called with the
+// parsed form instead of Migrate, and the form is re-encoded afterwards. Other
+// bodies are still migrated with Migrate.
+type FormMigration interface {
+	MigrateForm(form *multipart.Form) error
+}
+
+// ValuesMigration is implemented by request migrations that transform
+// application/x-www-form-urlencoded bodies. For such bodies, MigrateValues is
+// called with the parsed values instead of Migrate, and the returned values
+// are re-encoded afterwards. Other bodies are still migrated with Migrate.
+type ValuesMigration interface {
+	MigrateValues(v url.Values) (url.Values, error)
+}
+
+func isMultipartForm(header http.Header) bool {
+	return mediaType(header) == "multipart/form-data"
+}
+
+func isURLEncodedForm(header http.Header) bool {
+	return mediaType(header) == "application/x-www-form-urlencoded"
+}
+
+func mediaType(header http.Header) string {
+	mt, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return mt
+}
+
+func (m *migrator) applyValuesMigrations(ctx context.Context, data []byte, handler string) ([]byte, error) {
+	// forms are only migrated forward.
+	if m.ahead {
+		return data, nil
+	}
+
+	chain, err := m.requestMigrations(ctx, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []migrationStep
+	for _, step := range chain {
+		if _, ok := unwrapMigration(step.migration).(ValuesMigration); ok && m.shouldMigrate(step.migration, DirectionRequest, data) {
+			steps = append(steps, step)
+		}
+	}
+
+	if len(steps) == 0 {
+		return data, nil
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range steps {
+		values, err = unwrapMigration(step.migration).(ValuesMigration).MigrateValues(values)
+		if err != nil {
+			return nil, step.error(handler, DirectionRequest, err)
+		}
+
+		m.record(handler, step, DirectionRequest)
+	}
+
+	return []byte(values.Encode()), nil
+}
+
+func (m *migrator) applyFormMigrations(ctx context.Context, data []byte, header http.Header, handler string) ([]byte, error) {
+	// forms are only migrated forward.
+	if m.ahead {
+		return data, nil
+	}
+
+	chain, err := m.requestMigrations(ctx, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []migrationStep
+	for _, step := range chain {
+		if _, ok := unwrapMigration(step.migration).(FormMigration); ok && m.shouldMigrate(step.migration, DirectionRequest, data) {
+			steps = append(steps, step)
+		}
+	}
+
+	if len(steps) == 0 {
+		return data, nil
+	}
+
+	_, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	boundary := params["boundary"]
+	form, err := multipart.NewReader(bytes.NewReader(data), boundary).ReadForm(maxFormMemory)
+	if err != nil {
+		return nil, err
+	}
+	defer form.RemoveAll()
+
+	for _, step := range steps {
+		err = unwrapMigration(step.migration).(FormMigration).MigrateForm(form)
+		if err != nil {
+			return nil, step.error(handler, DirectionRequest, err)
+		}
+
+		m.record(handler, step, DirectionRequest)
+	}
+
+	return encodeForm(form, boundary)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// encodeForm encodes form using boundary, so the request's Content-Type
+// header remains valid.
+func encodeForm(form *multipart.Form, boundary string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	err := w.SetBoundary(boundary)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range sortedKeys(form.Value) {
+		for _, v := range form.Value[k] {
+			err = w.WriteField(k, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, k := range sortedKeys(form.File) {
+		for _, fh := range form.File[k] {
+			err = writeFormFile(w, k, fh)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeFormFile(w *multipart.Writer, name string, fh *multipart.FileHeader) error {
+	h := make(textproto.MIMEHeader)
+	for k, v := range fh.Header {
+		h[k] = v
+	}
+
+	// the field may have been renamed by a migration.
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(name), quoteEscaper.Replace(fh.Filename)))
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(part, f)
+	return err
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,75 @@
+package requestmigrations
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GenerateGraphviz returns a DOT graph of the registered versions, oldest
+// first, with an edge between consecutive versions labelled by the
+// descriptions of the newer version's migrations, e.g. to render with
+// `dot -Tsvg`. The current version is drawn in bold, and migrations
+// registered with RegisterConstraint aren't shown.
+func (rm *RequestMigration) GenerateGraphviz() (string, error) {
+	var buf bytes.Buffer
+	err := rm.writeGraphviz(&buf)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func (rm *RequestMigration) writeGraphviz(w io.Writer) error {
+	current := rm.getCurrentVersion()
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	_, err := fmt.Fprintln(w, "digraph migrations {\n\trankdir=LR;")
+	if err != nil {
+		return err
+	}
+
+	for _, v := range rm.versions {
+		attrs := ""
+		switch {
+		case v.String() == rm.iv:
+			attrs = fmt.Sprintf(" [label=%s, style=dashed]", dotQuote("initial"))
+		case v.Equal(current):
+			attrs = " [style=bold]"
+		}
+
+		_, err = fmt.Fprintf(w, "\t%s%s;\n", dotQuote(v.String()), attrs)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 1; i < len(rm.versions); i++ {
+		from, to := rm.versions[i-1].String(), rm.versions[i].String()
+
+		var descriptions []string
+		for _, migration := range rm.migrations[to] {
+			descriptions = append(descriptions, describe(migration))
+		}
+
+		_, err = fmt.Fprintf(w, "\t%s -> %s [label=%s];\n",
+			dotQuote(from), dotQuote(to), dotQuote(strings.Join(descriptions, "\n")))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote returns s as a quoted DOT ID.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,66 @@
+package requestmigrations
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderMigration is implemented by migrations that only change headers,
+// e.g. a header renamed between versions. When a migration implements it,
+// MigrateHeader is called instead of Migrate with the payload's headers to
+// change in place, and the body is passed through untouched. A migration
+// whose name has Request or Response after the handler's name is applied in
+// that direction, like Migrate; one whose name has neither, e.g.
+// createUserDeprecationHeaderMigration, is applied to both requests and
+// responses. Header migrations are the only ones that run for payloads whose
+// body isn't migrated, e.g. GET requests and empty responses.
+//
+// Types that don't also implement Migration can be registered with
+// HeaderOnly.
+type HeaderMigration interface {
+	MigrateHeader(h http.Header) error
+}
+
+// HeaderOnly adapts m so it can be registered alongside other migrations.
+func HeaderOnly(m HeaderMigration) Migration {
+	return &headerMigration{m}
+}
+
+type headerMigration struct {
+	HeaderMigration
+}
+
+func (m *headerMigration) Migrate(data []byte, header http.Header) ([]byte, http.Header, error) {
+	return migrateHeader(m.HeaderMigration, data, header)
+}
+
+// isHeaderMigration reports whether migration only changes headers.
+func isHeaderMigration(migration Migration) bool {
+	_, ok := unwrapMigration(migration).(HeaderMigration)
+	return ok
+}
+
+// isUndirectedHeaderMigration reports whether migration is a header
+// migration applied in both directions, as suffix, the lowercase part of its
+// name after the handler's name, doesn't say which one it applies to.
+func isUndirectedHeaderMigration(migration Migration, suffix string) bool {
+	if !isHeaderMigration(migration) {
+		return false
+	}
+
+	return !strings.Contains(suffix, string(DirectionRequest)) && !strings.Contains(suffix, string(DirectionResponse))
+}
+
+// migrateHeader runs hm on header, returning data as is.
+func migrateHeader(hm HeaderMigration, data []byte, header http.Header) ([]byte, http.Header, error) {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	err := hm.MigrateHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, header, nil
+}
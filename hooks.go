@@ -0,0 +1,106 @@
+package requestmigrations
+
+import (
+	"context"
+	"net/http"
+)
+
+// MigrationHook is called once per request with the client's version, see
+// AddPreMigrationHook and AddPostMigrationHook.
+type MigrationHook func(ctx context.Context, v *Version, r *http.Request) error
+
+// AddPreMigrationHook registers fn to run once per request, once its version
+// is resolved and before its request migrations, whichever handler it's for,
+// e.g. to stamp a correlation ID. It's called for requests on the current
+// version too, and not for requests whose version can't be resolved or that
+// skip migrations. An error from fn aborts the request: Migrate returns it
+// regardless of OnMigrationError.
+func (rm *RequestMigration) AddPreMigrationHook(fn MigrationHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.preHooks = append(rm.preHooks[:len(rm.preHooks):len(rm.preHooks)], fn)
+}
+
+// AddPostMigrationHook registers fn to run once per response, before it's
+// written and after its response migrations if any, for the same requests as
+// the pre-migration hooks. An error from fn fails the response, and is
+// handled according to OnMigrationError.
+func (rm *RequestMigration) AddPostMigrationHook(fn MigrationHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.postHooks = append(rm.postHooks[:len(rm.postHooks):len(rm.postHooks)], fn)
+}
+
+// hookError marks an error returned by a pre-migration hook, so it aborts
+// the request whatever the OnMigrationError policy.
+type hookError struct {
+	err error
+}
+
+func (e *hookError) Error() string {
+	return e.err.Error()
+}
+
+func (e *hookError) Unwrap() error {
+	return e.err
+}
+
+// runPreHooks runs the pre-migration hooks for r, whose version is v. They
+// only run once, even when Migrate is called again for r.
+func (rm *RequestMigration) runPreHooks(r *http.Request, v *Version) error {
+	pre, _ := rm.hooks()
+	if len(pre) == 0 || hooksRan(r) {
+		return nil
+	}
+
+	setContextValue(r, hooksKey, true)
+	return rm.runHooks(pre, v, r)
+}
+
+// runPostHooks runs the post-migration hooks for the response to r, whose
+// client is on v. v is resolved when it's nil; the hooks are skipped when it
+// can't be, like the pre-migration hooks.
+func (rm *RequestMigration) runPostHooks(r *http.Request, v *Version) error {
+	_, post := rm.hooks()
+	if len(post) == 0 || !rm.hasMigrations() {
+		return nil
+	}
+
+	if v == nil {
+		var err error
+		v, err = rm.getDirectionVersion(r, rm.opts.ResponseVersionFunc)
+		if err != nil {
+			return nil
+		}
+	}
+
+	return rm.runHooks(post, v, r)
+}
+
+// runHooks calls hooks in order, stopping at the first error.
+func (rm *RequestMigration) runHooks(hooks []MigrationHook, v *Version, r *http.Request) error {
+	for _, fn := range hooks {
+		err := fn(r.Context(), v, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hooksRan reports whether the pre-migration hooks ran for r.
+func hooksRan(r *http.Request) bool {
+	ran, _ := r.Context().Value(hooksKey).(bool)
+	return ran
+}
+
+// hooks returns the registered pre-migration and post-migration hooks.
+func (rm *RequestMigration) hooks() (pre, post []MigrationHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.preHooks, rm.postHooks
+}
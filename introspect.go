@@ -0,0 +1,298 @@
+package requestmigrations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Describer is implemented by migrations that describe the change they make,
+// e.g. for changelogs. Migrations that don't implement it are described by
+// the name of their type.
+type Describer interface {
+	Description() string
+}
+
+func describe(migration Migration) string {
+	if d, ok := unwrapMigration(migration).(Describer); ok {
+		return d.Description()
+	}
+
+	return migrationName(migration)
+}
+
+// MigrationsForHandler returns the descriptions of the request and response
+// migrations that apply to handler, keyed by version. Versions without any
+// matching migration are omitted.
+func (rm *RequestMigration) MigrationsForHandler(handler string) map[string][]string {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	m := &migrator{}
+	descriptions := make(map[string][]string)
+	for version, migrations := range rm.migrations {
+		req := m.retrieveHandlerRequestMigration(migrations, handler)
+		res := m.retrieveHandlerResponseMigration(migrations, handler)
+		if res == req {
+			// directional migrations handle both directions.
+			res = nil
+		}
+
+		for _, migration := range []Migration{req, res} {
+			if migration != nil {
+				descriptions[version] = append(descriptions[version], describe(migration))
+			}
+		}
+	}
+
+	return descriptions
+}
+
+// PlannedMigration is a migration that would run on a request or its
+// response, moving the payload from version From to version To.
+type PlannedMigration struct {
+	Direction   Direction `json:"direction"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Migration   string    `json:"migration"`
+	Description string    `json:"description"`
+}
+
+// Plan returns the migrations Migrate would run on r and its response for
+// handler, in the order they'd run: the request's first, then the
+// response's. Nothing is migrated and r's body isn't read. Response
+// migrations that only apply to some status codes are included, since the
+// status isn't known yet.
+func (rm *RequestMigration) Plan(r *http.Request, handler string) ([]PlannedMigration, error) {
+	plan := []PlannedMigration{}
+	if !rm.hasMigrations() || rm.skipMigrations(r, handler) {
+		return plan, nil
+	}
+
+	to := rm.getCurrentVersion()
+
+	from, err := rm.getDirectionVersion(r, rm.opts.RequestVersionFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !from.Equal(to) {
+		if !rm.isKnownVersion(from) {
+			return nil, ErrUnknownVersion
+		}
+
+		m, err := rm.newMigrator(from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		chain, err := m.chainFor(r.Context(), handler, DirectionRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		plan = appendPlan(plan, DirectionRequest, chain)
+	}
+
+	from, err = rm.responseVersion(r, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	if from != nil {
+		m, err := rm.newMigrator(from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		chain, err := m.chainFor(r.Context(), handler, DirectionResponse)
+		if err != nil {
+			return nil, err
+		}
+
+		plan = appendPlan(plan, DirectionResponse, chain)
+	}
+
+	return plan, nil
+}
+
+// chainFor returns the steps that migrate a payload going in direction. For
+// clients ahead of the current version, requests are migrated back with the
+// response migrations and responses forward with the request migrations.
+func (m *migrator) chainFor(ctx context.Context, handler string, direction Direction) ([]migrationStep, error) {
+	if (direction == DirectionRequest) != m.ahead {
+		return m.requestMigrations(ctx, handler)
+	}
+
+	return m.responseMigrations(ctx, handler)
+}
+
+func appendPlan(plan []PlannedMigration, direction Direction, chain []migrationStep) []PlannedMigration {
+	for _, step := range chain {
+		plan = append(plan, PlannedMigration{
+			Direction:   direction,
+			From:        step.from.String(),
+			To:          step.to.String(),
+			Migration:   migrationName(step.migration),
+			Description: describe(step.migration),
+		})
+	}
+
+	return plan
+}
+
+// Validate checks the registered migrations for likely mistakes. It returns
+// an error wrapping ErrMigrationGap when a version has no migrations while
+// the versions on both sides of it do, which usually means the version's
+// migrations were never registered. It returns an error wrapping
+// ErrInvalidVersion when DefaultVersion or CanaryVersion isn't registered.
+func (rm *RequestMigration) Validate() error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if v := rm.opts.DefaultVersion; !isStringEmpty(v) && rm.indexOf(v) < 0 {
+		return fmt.Errorf("%w: default version %s isn't registered", ErrInvalidVersion, v)
+	}
+
+	if v := rm.opts.CanaryVersion; !isStringEmpty(v) && rm.indexOf(v) < 0 {
+		return fmt.Errorf("%w: canary version %s isn't registered", ErrInvalidVersion, v)
+	}
+
+	var gaps []string
+	for i := 1; i < len(rm.versions)-1; i++ {
+		prev := rm.migrations[rm.versions[i-1].String()]
+		curr := rm.migrations[rm.versions[i].String()]
+		next := rm.migrations[rm.versions[i+1].String()]
+
+		if len(curr) == 0 && len(prev) > 0 && len(next) > 0 {
+			gaps = append(gaps, rm.versions[i].String())
+		}
+	}
+
+	if len(gaps) > 0 {
+		return fmt.Errorf("%w: %s", ErrMigrationGap, strings.Join(gaps, ", "))
+	}
+
+	return nil
+}
+
+// WillMigrate reports whether any migration would transform handler's
+// payloads going in direction for a client on version, e.g. so clients can
+// tell whether upgrading changes an endpoint for them. It's false for
+// versions that aren't registered.
+func (rm *RequestMigration) WillMigrate(version, handler string, direction Direction) bool {
+	v := rm.newVersion(version)
+	to := rm.getCurrentVersion()
+	if v.Equal(to) || !rm.isKnownVersion(v) {
+		return false
+	}
+
+	if direction == DirectionResponse && rm.isExcluded(handler) {
+		return false
+	}
+
+	m, err := rm.newMigrator(v, to)
+	if err != nil {
+		return false
+	}
+
+	chain, err := m.chainFor(context.Background(), handler, direction)
+	return err == nil && len(chain) > 0
+}
+
+// MigrationCapability reports whether a handler's requests and responses are
+// migrated for a version.
+type MigrationCapability struct {
+	Version  string `json:"version"`
+	Handler  string `json:"handler"`
+	Request  bool   `json:"request"`
+	Response bool   `json:"response"`
+}
+
+// WillMigrateHandler returns a handler reporting, as JSON, whether the
+// handler named by the handler query parameter migrates requests and
+// responses for the version query parameter, or the caller's own version
+// when it's omitted.
+func (rm *RequestMigration) WillMigrateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		handler := query.Get("handler")
+		if isStringEmpty(handler) {
+			http.Error(w, "handler is required", http.StatusBadRequest)
+			return
+		}
+
+		version := query.Get("version")
+		if isStringEmpty(version) {
+			v, err := rm.getUserVersion(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			version = v.String()
+		}
+
+		body, err := json.Marshal(&MigrationCapability{
+			Version:  version,
+			Handler:  handler,
+			Request:  rm.WillMigrate(version, handler, DirectionRequest),
+			Response: rm.WillMigrate(version, handler, DirectionResponse),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// VersionInfo describes the versions a server supports.
+type VersionInfo struct {
+	Current   string   `json:"current"`
+	Default   string   `json:"default"`
+	Supported []string `json:"supported"`
+	Header    string   `json:"header,omitempty"`
+}
+
+// VersionInfoHandler returns a handler that reports the current, default and
+// supported versions as JSON, so clients don't need to hardcode them.
+func (rm *RequestMigration) VersionInfoHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(rm.versionInfo())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+func (rm *RequestMigration) versionInfo() *VersionInfo {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	supported := []string{}
+	for _, v := range rm.versions {
+		// the initial version is internal, clients never send it.
+		if v.String() == rm.iv {
+			continue
+		}
+
+		supported = append(supported, v.String())
+	}
+
+	return &VersionInfo{
+		Current:   rm.opts.CurrentVersion,
+		Default:   rm.defaultVersion(),
+		Supported: supported,
+		Header:    rm.opts.VersionHeader,
+	}
+}
@@ -0,0 +1,133 @@
+package requestmigrations
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintWarning reports a registered migration that can never run.
+type LintWarning struct {
+	Version   string
+	Migration string
+	Reason    string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s: %s %s", w.Version, w.Migration, w.Reason)
+}
+
+// Lint reports migrations that can never run, in version order:
+//
+//   - migrations registered under the oldest version, usually one that sorts
+//     before the initial version, since chains start after their from version;
+//   - migrations whose type name matches no handler, because it doesn't have
+//     the handler's name followed by "request" or "response";
+//   - migrations shadowed by an earlier migration of the same version for the
+//     same handler and direction, since only the first one runs.
+//
+// Migrations added with RegisterFunc are checked for the first and the last.
+// Other Directional and HandlerPattern migrations, and header migrations
+// applied in both directions, are only checked for the first.
+func (rm *RequestMigration) Lint() []LintWarning {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	var warnings []LintWarning
+	for i, version := range rm.versions {
+		key := version.String()
+		seen := make(map[string]string)
+
+		for _, migration := range rm.migrations[key] {
+			name := migrationName(migration)
+			warn := func(reason string) {
+				warnings = append(warnings, LintWarning{Version: key, Migration: name, Reason: reason})
+			}
+
+			if i == 0 {
+				warn("is registered under the oldest version, which no chain migrates to")
+				continue
+			}
+
+			// function migrations run in both directions, and shadow the
+			// migrations registered after them for their handler.
+			if f, ok := unwrapMigration(migration).(*funcMigration); ok {
+				targets := []string{
+					strings.ToLower(f.handler) + string(DirectionRequest),
+					strings.ToLower(f.handler) + string(DirectionResponse),
+				}
+
+				for _, target := range targets {
+					if by, ok := seen[target]; ok {
+						warn(fmt.Sprintf("is shadowed by %s, registered before it for the same handler", by))
+						break
+					}
+				}
+
+				for _, target := range targets {
+					if _, ok := seen[target]; !ok {
+						seen[target] = name
+					}
+				}
+
+				continue
+			}
+
+			if _, ok := asDirectional(migration); ok {
+				continue
+			}
+
+			targets := migrationTargets(name)
+			if len(targets) == 0 {
+				_, ok := unwrapMigration(migration).(HandlerPattern)
+				if !ok && !isHeaderMigration(migration) {
+					warn(`matches no handler, its name has no "request" or "response" after a handler name`)
+				}
+
+				continue
+			}
+
+			if _, ok := unwrapMigration(migration).(HandlerPattern); ok {
+				continue
+			}
+
+			shadowed := true
+			for _, target := range targets {
+				if _, ok := seen[target]; !ok {
+					shadowed = false
+				}
+			}
+
+			if shadowed {
+				warn(fmt.Sprintf("is shadowed by %s, registered before it for the same handler", seen[targets[0]]))
+				continue
+			}
+
+			for _, target := range targets {
+				if _, ok := seen[target]; !ok {
+					seen[target] = name
+				}
+			}
+		}
+	}
+
+	return warnings
+}
+
+// migrationTargets returns the lowercase handler and direction prefixes the
+// type name matches, e.g. "createuserrequest" for
+// createUserRequestSplitNameMigration.
+func migrationTargets(name string) []string {
+	name = strings.ToLower(name)
+
+	var targets []string
+	for _, direction := range []Direction{DirectionRequest, DirectionResponse} {
+		d := string(direction)
+		for i := 1; i < len(name); i++ {
+			if strings.HasPrefix(name[i:], d) {
+				targets = append(targets, name[:i+len(d)])
+			}
+		}
+	}
+
+	return targets
+}
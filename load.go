@@ -0,0 +1,165 @@
+package requestmigrations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// fieldOperation is one operation in the format LoadMigrations reads.
+type fieldOperation struct {
+	Handler string `json:"handler"`
+	Op      string `json:"op"`
+	Field   string `json:"field"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Value   any    `json:"value"`
+}
+
+// LoadMigrations registers migrations declared in JSON, so simple field
+// changes can be added without writing Go. The document maps each version to
+// the operations it introduced, each naming the handler it applies to:
+//
+//	{
+//		"2023-03-01": [
+//			{"handler": "createUser", "op": "rename", "from": "username", "to": "email"},
+//			{"handler": "createUser", "op": "add", "field": "role", "value": "member"}
+//		]
+//	}
+//
+// The operations are
+//
+//   - rename: renames the field from to to, see RenameField.
+//   - drop: removes field, which older clients are sent set to value, or
+//     null without one.
+//   - add: adds field, backfilled with value for older clients' requests
+//     and removed from their responses.
+//   - move: moves the value at the JSON pointer from to the pointer to, see
+//     MoveField.
+//   - coerce: converts field from the type from to the type to, see
+//     CoerceType.
+//
+// A version's operations for a handler are registered as a single migration,
+// like one added with RegisterFunc: requests apply them in order and
+// responses apply their inverses in reverse order. Like RegisterFunc, it
+// returns ErrMigrationConflict if a version already has a migration for one
+// of the handlers. Nothing is registered when the document is invalid.
+func (rm *RequestMigration) LoadMigrations(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+
+	var doc map[string][]fieldOperation
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("invalid migrations: %w", err)
+	}
+
+	type loaded struct {
+		version, handler  string
+		forward, backward []FieldTransform
+	}
+
+	store := MigrationStore{}
+	var migrations []*loaded
+	for version, ops := range doc {
+		store[version] = Migrations{}
+		byHandler := map[string]*loaded{}
+		for i, op := range ops {
+			if op.Handler == "" {
+				return fmt.Errorf("version %s: operation %d: missing handler", version, i)
+			}
+
+			forward, backward, err := op.transforms()
+			if err != nil {
+				return fmt.Errorf("version %s: operation %d: %w", version, i, err)
+			}
+
+			l, ok := byHandler[op.Handler]
+			if !ok {
+				l = &loaded{version: version, handler: op.Handler}
+				byHandler[op.Handler] = l
+				migrations = append(migrations, l)
+			}
+
+			l.forward = append(l.forward, forward)
+			l.backward = append([]FieldTransform{backward}, l.backward...)
+		}
+	}
+
+	for _, l := range migrations {
+		migration := newFuncMigration(l.version, l.handler, fieldTransformFunc(l.forward), fieldTransformFunc(l.backward))
+		store[l.version] = append(store[l.version], migration)
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	for _, l := range migrations {
+		err := rm.checkFuncConflict(l.version, l.handler)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rm.addMigrations(store, true)
+}
+
+// transforms returns the transforms applying op to requests and undoing it
+// for responses.
+func (op fieldOperation) transforms() (forward, backward FieldTransform, err error) {
+	switch op.Op {
+	case "rename":
+		if op.From == "" || op.To == "" {
+			return nil, nil, errors.New("rename needs from and to")
+		}
+
+		return RenameField(op.From, op.To), RenameField(op.To, op.From), nil
+
+	case "drop":
+		if op.Field == "" {
+			return nil, nil, errors.New("drop needs field")
+		}
+
+		return DropField(op.Field), AddField(op.Field, op.Value), nil
+
+	case "add":
+		if op.Field == "" {
+			return nil, nil, errors.New("add needs field")
+		}
+
+		return DefaultField(op.Field, op.Value), DropField(op.Field), nil
+
+	case "move":
+		if op.From == "" || op.To == "" {
+			return nil, nil, errors.New("move needs from and to")
+		}
+
+		return MoveField(op.From, op.To), MoveField(op.To, op.From), nil
+
+	case "coerce":
+		if op.Field == "" || op.From == "" || op.To == "" {
+			return nil, nil, errors.New("coerce needs field, from and to")
+		}
+
+		from, to := FieldType(op.From), FieldType(op.To)
+		for _, t := range []FieldType{from, to} {
+			if t != StringField && t != NumberField && t != BoolField {
+				return nil, nil, fmt.Errorf("unknown field type %q", t)
+			}
+		}
+
+		return CoerceType(op.Field, from, to, CoerceFail), CoerceType(op.Field, to, from, CoerceFail), nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// fieldTransformFunc returns a MigrateFunc applying transforms to the body.
+func fieldTransformFunc(transforms []FieldTransform) MigrateFunc {
+	return func(data []byte, header http.Header) ([]byte, http.Header, error) {
+		data, err := ApplyFieldTransforms(data, transforms...)
+		return data, header, err
+	}
+}
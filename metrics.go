@@ -0,0 +1,45 @@
+package requestmigrations
+
+import (
+	"strings"
+)
+
+// MetricLabeler is implemented by migrations that tag the latency histogram
+// with extra labels, e.g. a semantic name for dashboards. Only the labels
+// named in RequestMigrationOptions.MetricLabels are used, others are ignored.
+type MetricLabeler interface {
+	MetricLabels() map[string]string
+}
+
+// collectLabels records the metric labels set by migration, in chain order.
+func (m *migrator) collectLabels(migration Migration) {
+	ml, ok := unwrapMigration(migration).(MetricLabeler)
+	if !ok {
+		return
+	}
+
+	if m.labels == nil {
+		m.labels = make(map[string][]string)
+	}
+
+	for k, v := range ml.MetricLabels() {
+		m.labels[k] = append(m.labels[k], v)
+	}
+}
+
+// metricLabels returns the values of the extra labels names for the chain.
+// Labels set by several migrations are joined with "+", and labels no
+// migration set are empty.
+func (m *migrator) metricLabels(names []string) map[string]string {
+	labels := make(map[string]string, len(names))
+	for _, name := range names {
+		var values []string
+		if m != nil {
+			values = m.labels[name]
+		}
+
+		labels[name] = strings.Join(values, "+")
+	}
+
+	return labels
+}
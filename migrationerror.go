@@ -0,0 +1,25 @@
+package requestmigrations
+
+import "fmt"
+
+// MigrationError is returned by Migrate, Convert and the other migration
+// entry points when a migration fails. From and To are the versions of the
+// step that failed, in the direction it migrates the payload, so a response
+// step runs from the newer version to the older one. Err is the cause.
+type MigrationError struct {
+	From          string
+	To            string
+	Handler       string
+	Direction     Direction
+	MigrationName string
+	Err           error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("%s migration %s for handler %s from %s to %s: %v",
+		e.Direction, e.MigrationName, e.Handler, e.From, e.To, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
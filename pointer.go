@@ -0,0 +1,204 @@
+package requestmigrations
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RenamePointer returns a transform moving the value at the RFC 6901 JSON
+// Pointer from to the pointer to, e.g. /users/0/profile/email to
+// /users/0/email. to's parent must exist: in an object the last token is set,
+// in an array it replaces an existing element, or appends with "-". An object
+// moved onto an existing object is merged into it with DeepMerge. Bodies
+// without from are left untouched. Its inverse is RenamePointer(to, from),
+// except for merged objects: moving one back takes the whole merged object,
+// including the fields to already had.
+func RenamePointer(from, to string) FieldTransform {
+	return func(m map[string]any) error {
+		src, err := parsePointer(from)
+		if err != nil {
+			return err
+		}
+
+		dst, err := parsePointer(to)
+		if err != nil {
+			return err
+		}
+
+		_, v, found := removePointer(m, src)
+		if !found {
+			return nil
+		}
+
+		_, ok := setPointer(m, dst, v, true)
+		if !ok {
+			return fmt.Errorf("pointer %s: parent not found", to)
+		}
+
+		return nil
+	}
+}
+
+// RemovePointer returns a transform removing the value at the RFC 6901 JSON
+// Pointer ptr. Array elements after a removed one are shifted down. Bodies
+// without ptr are left untouched.
+func RemovePointer(ptr string) FieldTransform {
+	return func(m map[string]any) error {
+		tokens, err := parsePointer(ptr)
+		if err != nil {
+			return err
+		}
+
+		removePointer(m, tokens)
+		return nil
+	}
+}
+
+// ReplacePointer returns a transform setting the value at the RFC 6901 JSON
+// Pointer ptr to value. Only existing values are replaced, bodies without ptr
+// are left untouched.
+func ReplacePointer(ptr string, value any) FieldTransform {
+	return func(m map[string]any) error {
+		tokens, err := parsePointer(ptr)
+		if err != nil {
+			return err
+		}
+
+		setPointer(m, tokens, value, false)
+		return nil
+	}
+}
+
+// pointerUnescaper decodes tokens in a single pass, so "~01" is read as "~1"
+// as RFC 6901 requires.
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parsePointer splits the JSON Pointer ptr into its unescaped reference
+// tokens. The root pointer "" is rejected, as the transforms can't replace
+// the body itself.
+func parsePointer(ptr string) ([]string, error) {
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex returns the element of an array of length n that token refers
+// to. Per RFC 6901, indices are decimal without leading zeros.
+func arrayIndex(token string, n int) (int, bool) {
+	if len(token) > 1 && token[0] == '0' {
+		return 0, false
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= n {
+		return 0, false
+	}
+
+	return i, true
+}
+
+// removePointer removes the value at tokens from node. It returns node, which
+// changes when an array element is removed, and the removed value.
+func removePointer(node any, tokens []string) (any, any, bool) {
+	last := len(tokens) == 1
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return node, nil, false
+		}
+
+		if last {
+			delete(n, tokens[0])
+			return n, child, true
+		}
+
+		child, v, found := removePointer(child, tokens[1:])
+		n[tokens[0]] = child
+		return n, v, found
+
+	case []any:
+		i, ok := arrayIndex(tokens[0], len(n))
+		if !ok {
+			return node, nil, false
+		}
+
+		if last {
+			v := n[i]
+			return append(n[:i:i], n[i+1:]...), v, true
+		}
+
+		child, v, found := removePointer(n[i], tokens[1:])
+		n[i] = child
+		return n, v, found
+	}
+
+	return node, nil, false
+}
+
+// setPointer sets the value at tokens in node to value. When add is false
+// only existing values are replaced; when it's true, missing object members
+// are added and an object set on an existing object member is merged into
+// it. It returns node, which changes when an element is appended to an
+// array, and whether the value was set.
+func setPointer(node any, tokens []string, value any, add bool) (any, bool) {
+	last := len(tokens) == 1
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if last {
+			if !ok && !add {
+				return node, false
+			}
+
+			dst, isMap := child.(map[string]any)
+			src, srcIsMap := value.(map[string]any)
+			if add && isMap && srcIsMap {
+				DeepMerge(dst, src)
+				return n, true
+			}
+
+			n[tokens[0]] = value
+			return n, true
+		}
+
+		if !ok {
+			return node, false
+		}
+
+		child, set := setPointer(child, tokens[1:], value, add)
+		n[tokens[0]] = child
+		return n, set
+
+	case []any:
+		if last && add && tokens[0] == "-" {
+			return append(n, value), true
+		}
+
+		i, ok := arrayIndex(tokens[0], len(n))
+		if !ok {
+			return node, false
+		}
+
+		if last {
+			n[i] = value
+			return n, true
+		}
+
+		child, set := setPointer(n[i], tokens[1:], value, add)
+		n[i] = child
+		return n, set
+	}
+
+	return node, false
+}
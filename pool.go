@@ -0,0 +1,32 @@
+package requestmigrations
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize caps the buffers kept in bufferPool, so a single large
+// request doesn't pin its memory for the lifetime of the process.
+const maxPooledBufferSize = 1 << 20
+
+// bufferPool holds the buffers request bodies are read into while they're
+// migrated. A buffer never outlives the Migrate call that got it: the body
+// the handler reads is always copied out of it first.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,27 @@
+package requestmigrations
+
+import (
+	"net/http"
+	"strings"
+)
+
+const previewNext = "next"
+
+// isPreview reports whether req asked to preview the next version.
+func (rm *RequestMigration) isPreview(req *http.Request) bool {
+	if isStringEmpty(rm.opts.PreviewHeader) {
+		return false
+	}
+
+	return strings.EqualFold(strings.TrimSpace(req.Header.Get(rm.opts.PreviewHeader)), previewNext)
+}
+
+// latestVersion returns the newest registered version, which may be newer
+// than the current version when the next one is registered ahead of its
+// release.
+func (rm *RequestMigration) latestVersion() *Version {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.versions[len(rm.versions)-1]
+}
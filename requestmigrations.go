@@ -2,10 +2,15 @@ package requestmigrations
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
@@ -21,11 +26,24 @@ const (
 	DateFormat   VersionFormat = "date"
 )
 
+// Direction is the direction a payload is migrated in. Requests are migrated
+// from the user's version to the current version and responses back.
+type Direction string
+
+const (
+	DirectionRequest  Direction = "request"
+	DirectionResponse Direction = "response"
+)
+
 var (
 	ErrServerError                 = errors.New("server error")
 	ErrInvalidVersion              = errors.New("invalid version number")
 	ErrInvalidVersionFormat        = errors.New("invalid version format")
 	ErrCurrentVersionCannotBeEmpty = errors.New("current version field cannot be empty")
+	ErrMigrationGap                = errors.New("version has no migrations between versions that do")
+	ErrUnknownVersion              = errors.New("none of the requested versions are supported")
+	ErrBodyTooLarge                = errors.New("request body too large to migrate")
+	ErrMigrationConflict           = errors.New("version already has a migration for handler")
 )
 
 // Migration is the core interface each transformation in every version
@@ -35,6 +53,14 @@ type Migration interface {
 	Migrate(data []byte, header http.Header) ([]byte, http.Header, error)
 }
 
+// HandlerPattern is implemented by migrations that target every handler
+// matching a pattern, rather than the handler their type name starts with.
+// The type name must still contain Request or Response, which determines the
+// direction the migration applies to.
+type HandlerPattern interface {
+	HandlerPattern() *regexp.Regexp
+}
+
 // Migrations is an array of migrations declared by each handler.
 type Migrations []Migration
 
@@ -59,6 +85,11 @@ type RequestMigrationOptions struct {
 	// map to the most recent version in the Migrations slice.
 	CurrentVersion string
 
+	// DefaultVersion refers to the version of requests that don't specify
+	// one. When it's empty, such requests are treated as older than every
+	// registered version and migrated through all of them.
+	DefaultVersion string
+
 	// GetUserHeaderFunc is a function to retrieve the user's version. This is useful
 	// where the user has a persistent version that necessarily being available in the
 	// request.
@@ -67,19 +98,181 @@ type RequestMigrationOptions struct {
 	// VersionFormat is used to specify the versioning format. The two supported types
 	// are DateFormat and SemverFormat.
 	VersionFormat VersionFormat
+
+	// VersionFormatFunc returns the format of each version, e.g.
+	// DetectVersionFormat, so date and semver versions can be registered
+	// side by side while a scheme is migrated; dates are ordered before
+	// semver versions. VersionFormat remains the format of the initial
+	// version.
+	VersionFormatFunc func(string) VersionFormat
+
+	// PathVersionPattern is a regular expression whose first capture group
+	// is the version in the request's path, e.g. `^/v(\d+)/` for /v2/users.
+	// It's tried after VersionHeader, so path versioned APIs don't need a
+	// header; the router is expected to strip the prefix before the handler.
+	// It's ignored when VersionResolvers is set, use PathResolver there.
+	PathVersionPattern string
+
+	// VersionResolvers is the chain used to retrieve the user's version. Each
+	// resolver is tried in order and the first non-empty version wins, the initial
+	// version is used when none of them returns one. If VersionResolvers is empty,
+	// the chain is VersionHeader, PathVersionPattern and GetUserVersionFunc.
+	VersionResolvers []VersionResolver
+
+	// RequestVersionFunc and ResponseVersionFunc retrieve the version a request is
+	// migrated from and the version its response is migrated to respectively. This
+	// is useful where both directions use different version sources. If either is
+	// nil or returns an empty version, the VersionResolvers chain is used instead.
+	RequestVersionFunc  GetUserVersionFunc
+	ResponseVersionFunc GetUserVersionFunc
+
+	// OnVersionResolved is called once per migrated request with the version the
+	// request was resolved to, e.g. to record which customers still use old
+	// versions. It's called synchronously on the request path, so it shouldn't
+	// block; hand slow work off to a goroutine or a queue. v may be shared
+	// between requests and must not be modified.
+	OnVersionResolved func(req *http.Request, v *Version)
+
+	// EnvelopeCodec is used to unwrap request and response bodies before they're
+	// migrated and wrap them back afterwards, e.g. ConnectEnvelopeCodec for
+	// Connect's framing. Bodies are migrated as is when it's nil.
+	EnvelopeCodec EnvelopeCodec
+
+	// EnvelopePath is a shorthand for a JSONPathEnvelopeCodec, for JSON bodies
+	// nesting their payload under a key such as "data". Bodies without the key,
+	// e.g. error responses, are passed through untouched. It can't be combined
+	// with EnvelopeCodec.
+	EnvelopePath string
+
+	// FeatureGate, if set, is consulted before each migration in a chain runs and
+	// the migration is skipped when it returns false. This is useful to roll a
+	// version's transformations out gradually.
+	FeatureGate FeatureGate
+
+	// AuditSink, if set, records an AuditEntry for every migration applied to a
+	// request or response.
+	AuditSink AuditSink
+
+	// RequestIDHeader refers to the header used to retrieve the request ID
+	// recorded in audit entries. It defaults to X-Request-ID.
+	RequestIDHeader string
+
+	// TenantVersionFunc retrieves the version a request's tenant is pinned to,
+	// e.g. by contract. When it returns ok, its version overrides every other
+	// way of resolving the user's version.
+	TenantVersionFunc func(req *http.Request) (version string, ok bool)
+
+	// MigrationTimeout bounds how long each migration may run, migrations that
+	// exceed it fail with ErrMigrationTimeout. Migrations implementing
+	// ContextMigration receive a context carrying the deadline. Zero means no
+	// timeout.
+	MigrationTimeout time.Duration
+
+	// AllowSkipHeader lets clients bypass request and response migrations
+	// for a single request by setting SkipHeader to true, e.g. so a debugging
+	// client can see current version data during an incident. Skipped
+	// requests are logged.
+	AllowSkipHeader bool
+
+	// SkipHeader refers to the header honoured when AllowSkipHeader is set.
+	// It defaults to X-Skip-Migrations.
+	SkipHeader string
+
+	// MetricLabels names extra labels of the latency histogram, set by
+	// migrations implementing MetricLabeler. The names are fixed when the
+	// RequestMigration is created, so every migration should use the same
+	// set; a label a chain's migrations don't set is left empty. Keep the
+	// values few to control the histogram's cardinality.
+	MetricLabels []string
+
+	// MaxBodyBytes caps the size of request bodies read for migration,
+	// larger bodies fail with ErrBodyTooLarge. Zero means no limit.
+	MaxBodyBytes int64
+
+	// RecomputeETag recomputes the ETag of responses whose body was changed
+	// by a migration over the migrated body, so conditional requests from
+	// clients on older versions keep working; matching If-None-Match requests
+	// get a 304. When it's false such ETags are removed instead, since they
+	// describe the current version body.
+	RecomputeETag bool
+
+	// Clock is used to measure migration latency and timestamp audit
+	// entries. It defaults to the system clock.
+	Clock Clock
+
+	// CanaryVersion is served to a fraction of the requests that don't
+	// specify a version, e.g. to smoke-test a new version before making it
+	// the default. CanaryWeight is that fraction, between 0 and 1.
+	CanaryVersion string
+	CanaryWeight  float64
+
+	// CanaryRand is the source used to pick canary requests. It defaults to
+	// the math/rand global source; set a seeded one for reproducible tests.
+	CanaryRand *rand.Rand
+
+	// PreviewHeader is the header clients set to "next" to preview the
+	// newest registered version before CurrentVersion is promoted to it,
+	// e.g. "X-API-Preview". Their requests are migrated back to the current
+	// version and the responses forward to the newest one.
+	PreviewHeader string
+
+	// SetResponseVersionHeader makes Migrate set ResponseVersionHeader on
+	// responses to the version they're served as, i.e. the version they were
+	// migrated to, or the current version when they weren't. The header
+	// defaults to VersionHeader.
+	SetResponseVersionHeader bool
+	ResponseVersionHeader    string
+
+	// RejectEmptyVersionHeader makes requests that send VersionHeader with an
+	// empty or whitespace value fail with ErrInvalidVersion. By default such
+	// requests are treated as if they hadn't sent the header, and get the
+	// default version.
+	RejectEmptyVersionHeader bool
+
+	// MigratableContentTypes lists the media types of the request and
+	// response bodies that are migrated, e.g. "application/json" and
+	// "application/vnd.myapi+json"; an entry like "+json" matches every type
+	// with that suffix. Bodies of other types are passed through untouched.
+	// When it's empty, JSON responses and every request body are migrated.
+	MigratableContentTypes []string
+
+	// ResponseCodecs maps versions to the codec their migrated responses
+	// are encoded with, e.g. XML for a version whose clients predate JSON.
+	// Responses to versions without a codec, and to requests whose Accept
+	// header doesn't accept the codec's media type, stay JSON.
+	ResponseCodecs map[string]ResponseCodec
+
+	// OnMigrationError decides how requests and responses whose migration
+	// fails, or whose version isn't registered, are handled. It defaults to
+	// FailClosed.
+	OnMigrationError MigrationErrorPolicy
 }
 
+// FeatureGate reports whether the migration named migrationName, the name of
+// its type or the name RegisterFunc gave it, should run for the request with
+// context ctx.
+type FeatureGate func(ctx context.Context, migrationName string) bool
+
 type rollbackFn func(w http.ResponseWriter)
 
 // RequestMigration is the exported type responsible for handling request migrations.
 type RequestMigration struct {
-	opts     *RequestMigrationOptions
-	versions []*Version
-	metric   *prometheus.HistogramVec
-	iv       string
-
-	mu         sync.Mutex
-	migrations MigrationStore
+	opts      *RequestMigrationOptions
+	resolvers []VersionResolver
+	current   *Version
+	clock     Clock
+	envelope  EnvelopeCodec
+	versions  []*Version
+	metric    *prometheus.HistogramVec
+	iv        string
+
+	mu          sync.Mutex
+	migrations  MigrationStore
+	ordinals    map[string]int
+	constrained []constrainedMigration
+	excluded    map[string]struct{}
+	preHooks    []MigrationHook
+	postHooks   []MigrationHook
 }
 
 func NewRequestMigration(opts *RequestMigrationOptions) (*RequestMigration, error) {
@@ -91,10 +284,21 @@ func NewRequestMigration(opts *RequestMigrationOptions) (*RequestMigration, erro
 		return nil, ErrCurrentVersionCannotBeEmpty
 	}
 
+	if opts.CanaryWeight < 0 || opts.CanaryWeight > 1 {
+		return nil, errors.New("canary weight must be between 0 and 1")
+	}
+
+	for _, name := range opts.MetricLabels {
+		switch name {
+		case "from", "to", "direction":
+			return nil, fmt.Errorf("metric label %s is reserved", name)
+		}
+	}
+
 	me := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "requestmigrations_seconds",
-		Help: "The latency of request migrations from one version to another.",
-	}, []string{"from", "to"})
+		Help: "The latency of request and response migrations from one version to another.",
+	}, append([]string{"from", "to", "direction"}, opts.MetricLabels...))
 
 	var iv string
 	if opts.VersionFormat == DateFormat {
@@ -110,138 +314,729 @@ func NewRequestMigration(opts *RequestMigrationOptions) (*RequestMigration, erro
 	var versions []*Version
 	versions = append(versions, &Version{Format: opts.VersionFormat, Value: iv})
 
-	return &RequestMigration{
+	envelope := opts.EnvelopeCodec
+	if !isStringEmpty(opts.EnvelopePath) {
+		if envelope != nil {
+			return nil, errors.New("envelope path cannot be combined with an envelope codec")
+		}
+
+		envelope = JSONPathEnvelopeCodec{Path: opts.EnvelopePath}
+	}
+
+	var path *regexp.Regexp
+	if !isStringEmpty(opts.PathVersionPattern) {
+		var err error
+		path, err = regexp.Compile(opts.PathVersionPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path version pattern: %w", err)
+		}
+
+		if path.NumSubexp() < 1 {
+			return nil, errors.New("path version pattern must have a capture group")
+		}
+	}
+
+	resolvers := opts.VersionResolvers
+	if len(resolvers) == 0 {
+		resolvers = defaultResolvers(opts, path)
+	}
+
+	rm := &RequestMigration{
 		opts:       opts,
+		resolvers:  resolvers,
+		clock:      clockOrDefault(opts.Clock),
+		envelope:   envelope,
 		metric:     me,
 		iv:         iv,
 		versions:   versions,
 		migrations: migrations,
-	}, nil
+		ordinals:   map[string]int{iv: 0},
+	}
+	rm.current = rm.newVersion(opts.CurrentVersion)
+
+	return rm, nil
 }
 
 func (rm *RequestMigration) RegisterMigrations(migrations MigrationStore) error {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
-	for k, v := range migrations {
-		rm.migrations[k] = v
-		rm.versions = append(rm.versions, &Version{Format: rm.opts.VersionFormat, Value: k})
+	return rm.addMigrations(migrations, false)
+}
+
+// Merge adds other's migrations to rm, e.g. to extend a base set of
+// migrations shared as a library with a service's own. For versions
+// registered in both, other's migrations are added after rm's, so rm's take
+// precedence for a handler both migrate. Both must use the same version
+// format.
+func (rm *RequestMigration) Merge(other *RequestMigration) error {
+	if other == rm {
+		return nil
+	}
+
+	if other.opts.VersionFormat != rm.opts.VersionFormat {
+		return fmt.Errorf("%w: cannot merge %s versions into %s versions",
+			ErrInvalidVersionFormat, other.opts.VersionFormat, rm.opts.VersionFormat)
+	}
+
+	other.mu.Lock()
+	migrations := make(MigrationStore, len(other.migrations))
+	for k, v := range other.migrations {
+		if k != other.iv {
+			migrations[k] = v
+		}
+	}
+	constrained := other.constrained
+	other.mu.Unlock()
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	err := rm.addMigrations(migrations, true)
+	if err != nil {
+		return err
+	}
+
+	rm.constrained = append(rm.constrained[:len(rm.constrained):len(rm.constrained)], constrained...)
+	return nil
+}
+
+// addMigrations registers migrations. Versions that are already registered
+// have their migrations replaced, or extended when merge is set. The caller
+// must hold rm.mu.
+func (rm *RequestMigration) addMigrations(migrations MigrationStore, merge bool) error {
+	versions := make([]*Version, 0, len(migrations))
+	for k := range migrations {
+		v, err := NewVersion(rm.versionFormat(k), k)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, k)
+		}
+
+		versions = append(versions, v)
+	}
+
+	for _, v := range versions {
+		key := v.String()
+
+		existing, ok := rm.migrations[key]
+		if !ok {
+			rm.migrations[key] = migrations[key]
+			rm.versions = append(rm.versions, v)
+			continue
+		}
+
+		if merge {
+			// copy so neither store is modified.
+			rm.migrations[key] = append(existing[:len(existing):len(existing)], migrations[key]...)
+		} else {
+			rm.migrations[key] = migrations[key]
+		}
+	}
+
+	if rm.opts.VersionFormatFunc != nil {
+		sort.Slice(rm.versions, mixedVersionSorter(rm.versions))
+		rm.reindex()
+		return nil
 	}
 
 	switch rm.opts.VersionFormat {
 	case SemverFormat:
 		sort.Slice(rm.versions, semVerSorter(rm.versions))
 	case DateFormat:
-		sort.Slice(rm.versions, dateVersionSorter(rm.versions))
+		sort.Sort(newDateVersions(rm.versions))
 	default:
 		return ErrInvalidVersionFormat
 	}
 
+	rm.reindex()
+	return nil
+}
+
+// reindex rebuilds the ordinals of the sorted versions. The map is replaced
+// rather than updated, as copies made by WithForcedVersion share it. The
+// caller must hold rm.mu.
+func (rm *RequestMigration) reindex() {
+	ordinals := make(map[string]int, len(rm.versions))
+	for i, v := range rm.versions {
+		ordinals[v.String()] = i
+	}
+
+	rm.ordinals = ordinals
+}
+
+// Ordinal returns the position of the registered version in the version
+// order, the oldest registered version being 1, and whether it's registered.
+// Ordinals are assigned when versions are registered, so versions can be
+// ordered and compared as integers without parsing them again, while their
+// string remains their identity, e.g. in headers and MigrationStore keys.
+// Registering a version older than others shifts their ordinals.
+func (rm *RequestMigration) Ordinal(version string) (int, bool) {
+	i := rm.versionIndex(version)
+	if i <= 0 {
+		return 0, false
+	}
+
+	return i, true
+}
+
+// RegisterRange adds migration to every registered version from fromVersion
+// to toVersion inclusive, e.g. for a compatibility shim that applies to
+// several versions. Both versions must already be registered.
+func (rm *RequestMigration) RegisterRange(fromVersion, toVersion string, migration Migration) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	fi, ti := rm.indexOf(fromVersion), rm.indexOf(toVersion)
+	if fi < 0 || ti < 0 {
+		return ErrInvalidVersion
+	}
+
+	if fi > ti {
+		return fmt.Errorf("%w: %s is newer than %s", ErrInvalidVersion, fromVersion, toVersion)
+	}
+
+	for _, version := range rm.versions[fi : ti+1] {
+		key := version.String()
+
+		// copy so the caller's store isn't modified.
+		migrations := rm.migrations[key]
+		rm.migrations[key] = append(migrations[:len(migrations):len(migrations)], migration)
+	}
+
 	return nil
 }
 
+// ExcludeHandler disables response migrations for handler, e.g. for handlers
+// proxying payloads that must be served untouched. Its requests are still
+// migrated.
+func (rm *RequestMigration) ExcludeHandler(handler string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.excluded == nil {
+		rm.excluded = make(map[string]struct{})
+	}
+
+	rm.excluded[handler] = struct{}{}
+}
+
+func (rm *RequestMigration) isExcluded(handler string) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	_, ok := rm.excluded[handler]
+	return ok
+}
+
 // Migrate is the core API for apply transformations to your handlers. It should be
 // called at the start of your handler to transform the body attached to your request
 // before further processing. To transform the response as well, you need to use
 // the rollback and res function to roll changes back and set the handler response
-// respectively.
+// respectively. Error responses are migrated like any other response as long as
+// their status and body are set on res rather than written to the
+// http.ResponseWriter directly. If a response migration fails, rollback
+// responds with a 500 and no body.
+//
+// Migrate is idempotent for a given request, only the first call migrates the
+// request, subsequent calls (e.g. from a global middleware and a per-route
+// handler) leave the request untouched. Only the first call to rollback
+// writes the response, later calls do nothing.
 func (rm *RequestMigration) Migrate(r *http.Request, handler string) (error, *response, rollbackFn) {
-	err := rm.migrateRequest(r, handler)
-	if err != nil {
-		return err, nil, nil
+	skip := rm.skipMigrations(r, handler)
+	if !skip {
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		err := rm.migrateRequest(r, handler, buf)
+		if err != nil {
+			restoreBody(r, buf)
+
+			err = rm.handleMigrationError(r, handler, DirectionRequest, err)
+			if err != nil {
+				return err, nil, nil
+			}
+		}
 	}
 
-	res := &response{}
-	rollback := func(w http.ResponseWriter) {
-		res.body, err = rm.migrateResponse(r, res.body, handler)
+	p := &pending{rm: rm, r: r, handler: handler, skip: skip}
+	return nil, &p.res, p.rollback
+}
+
+// pending is the state of a request between Migrate and its rollback.
+type pending struct {
+	rm      *RequestMigration
+	r       *http.Request
+	handler string
+	skip    bool
+	res     response
+	done    bool
+}
+
+func (p *pending) rollback(w http.ResponseWriter) {
+	if p.done {
+		return
+	}
+	p.done = true
+
+	p.rm.writeResponse(w, p.r, p.handler, p.skip, &p.res)
+}
+
+// writeResponse migrates res, the handler's response to r, and writes it to
+// w. It's the body of the rollback function Migrate returns.
+func (rm *RequestMigration) writeResponse(w http.ResponseWriter, r *http.Request, handler string, skip bool, res *response) {
+	// error pages and other non-JSON bodies are passed through untouched.
+	ch := res.header
+	if ch.Get("Content-Type") == "" {
+		ch = w.Header()
+	}
+
+	// responses to HEAD requests are never sent with a body. Responses whose
+	// body isn't migrated still have their header migrated.
+	migratable := r.Method != http.MethodHead && len(res.body) > 0 && rm.isMigratable(ch, res.body)
+
+	var from *Version
+	var err error
+	if !skip {
+		from, err = rm.responseVersion(r, handler)
+		if err != nil && !migratable {
+			// unmigratable responses were always passed through.
+			from = nil
+		} else if err != nil {
+			err = rm.handleMigrationError(r, handler, DirectionResponse, err)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if from == nil {
+		if !skip {
+			err = rm.runPostHooks(r, nil)
+			if err != nil {
+				err = rm.handleMigrationError(r, handler, DirectionResponse, err)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		// nothing to migrate, so the header is updated in place rather
+		// than copied.
+		wh := w.Header()
+		for k, v := range res.header {
+			wh[k] = v
+		}
+		res.header = nil
+		rm.setResponseVersion(wh, rm.getCurrentVersion())
+
+		err = rm.writeResponseToClient(w, res)
+		return
+	}
+
+	header := w.Header().Clone()
+	for k, v := range res.header {
+		header[k] = v
+	}
+	res.header = header
+
+	status := res.statusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	served := from
+	body := res.body
+	if migratable {
+		body, header, err = rm.migrateResponse(r, from, status, res.body, res.header, handler)
+	} else {
+		header, err = rm.migrateResponseHeader(r, from, status, res.header, handler)
+	}
+	if err != nil {
+		err = rm.handleMigrationError(r, handler, DirectionResponse, err)
 		if err != nil {
-			// write an error to the client.
+			// don't serve a partially migrated or empty body as a success.
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		err = rm.writeResponseToClient(w, res)
+		body, header, served = res.body, res.header, rm.getCurrentVersion()
+	}
+
+	original := res.body
+	res.body, res.header = body, header
+	if codec, ok := rm.responseCodec(r, from); ok && migratable {
+		err = encodeResponse(res, codec)
+		if err != nil {
+			err = rm.handleMigrationError(r, handler, DirectionResponse, err)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	err = rm.runPostHooks(r, from)
+	if err != nil {
+		err = rm.handleMigrationError(r, handler, DirectionResponse, err)
 		if err != nil {
-			// write an error to the client.
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	}
 
-	return nil, res, rollback
+	rm.setResponseVersion(res.header, served)
+	if !bytes.Equal(original, res.body) {
+		// the handler's Content-Length describes the current version
+		// body.
+		res.header.Del("Content-Length")
+
+		if rm.refreshETag(r, res) {
+			res.statusCode = http.StatusNotModified
+			res.body = nil
+		}
+	}
+
+	err = rm.writeResponseToClient(w, res)
+	if err != nil {
+		// write an error to the client.
+		return
+	}
 }
 
-func (rm *RequestMigration) migrateRequest(r *http.Request, handler string) error {
-	from, err := rm.getUserVersion(r)
+func (rm *RequestMigration) migrateRequest(r *http.Request, handler string, buf *bytes.Buffer) error {
+	if !rm.hasMigrations() || isMigrated(r) {
+		return nil
+	}
+
+	from, err := rm.getDirectionVersion(r, rm.opts.RequestVersionFunc)
 	if err != nil {
+		markMigrated(r)
 		return err
 	}
 
+	if rm.opts.OnVersionResolved != nil {
+		rm.opts.OnVersionResolved(r, from)
+	}
+
+	err = rm.runPreHooks(r, from)
+	if err != nil {
+		markMigrated(r)
+		return &hookError{err}
+	}
+
+	// requests on the current version are left untouched, without reading
+	// their body or marking them migrated.
 	to := rm.getCurrentVersion()
-	m, err := Newmigrator(from, to, rm.versions, rm.migrations)
+	if from.Equal(to) {
+		return nil
+	}
+	defer markMigrated(r)
+
+	if !rm.isKnownVersion(from) {
+		return ErrUnknownVersion
+	}
+
+	m, err := rm.newMigrator(from, to)
 	if err != nil {
 		return err
 	}
+	m.url, m.method = r.URL, r.Method
 
-	if from.Equal(to) {
+	if m.auditSink != nil {
+		m.requestID = rm.requestID(r)
+	}
+
+	setContextValue(r, stepCountKey, m.StepCount())
+
+	startTime := rm.clock.Now()
+	defer rm.observeLatency(DirectionRequest, m, from, to, startTime)
+
+	if m.versions == nil {
 		return nil
 	}
 
-	startTime := time.Now()
-	defer rm.observeRequestLatency(from, to, startTime)
+	// bodyless requests, e.g. GET and HEAD, only have their header migrated.
+	if !hasBody(r) {
+		m.headerOnly = true
+
+		_, header, err := m.applyRequestMigrations(r.Context(), []byte{}, r.Header.Clone(), handler)
+		if err != nil {
+			return err
+		}
+
+		r.Header = header
+		return nil
+	}
+
+	body := io.Reader(r.Body)
+	if rm.opts.MaxBodyBytes > 0 {
+		// read one byte past the limit to tell a body of exactly
+		// MaxBodyBytes from a larger one.
+		body = io.LimitReader(r.Body, rm.opts.MaxBodyBytes+1)
+	}
+
+	_, err = buf.ReadFrom(body)
+	if err != nil {
+		return err
+	}
+
+	if rm.opts.MaxBodyBytes > 0 && int64(buf.Len()) > rm.opts.MaxBodyBytes {
+		return ErrBodyTooLarge
+	}
+
+	if len(rm.opts.MigratableContentTypes) > 0 && !rm.isMigratable(r.Header, buf.Bytes()) {
+		restoreBody(r, buf)
+		return nil
+	}
 
-	err = m.applyRequestMigrations(r, handler)
+	data, header, err := rm.migrateRequestBody(r.Context(), m, buf.Bytes(), r.Header.Clone(), handler)
 	if err != nil {
 		return err
 	}
 
+	r.Header = header
+
+	// set the body back for the rest of the middleware. data may still be
+	// backed by buf, which goes back to the pool once Migrate returns.
+	r.Body = io.NopCloser(bytes.NewReader(bytes.Clone(data)))
+
 	return nil
 }
 
-func (rm *RequestMigration) migrateResponse(r *http.Request, body []byte, handler string) ([]byte, error) {
-	from, err := rm.getUserVersion(r)
+func (rm *RequestMigration) migrateRequestBody(ctx context.Context, m *migrator, data []byte, header http.Header, handler string) ([]byte, http.Header, error) {
+	if isMultipartForm(header) {
+		data, err := m.applyFormMigrations(ctx, data, header, handler)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return data, header, nil
+	}
+
+	if isURLEncodedForm(header) {
+		data, err := m.applyValuesMigrations(ctx, data, handler)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return data, header, nil
+	}
+
+	message, err := rm.unwrapEnvelope(data)
+	if errors.Is(err, ErrNoMessage) {
+		return data, header, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, header, err = m.applyRequestMigrations(ctx, message, header, handler)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = rm.wrapEnvelope(data, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, header, nil
+}
+
+// responseMigrator builds the migrator for the response to r, with status
+// code status, from the current version back to from.
+func (rm *RequestMigration) responseMigrator(r *http.Request, from *Version, status int) (*migrator, error) {
+	m, err := rm.newMigrator(from, rm.getCurrentVersion())
 	if err != nil {
 		return nil, err
 	}
+	m.status = status
+	m.url, m.method = r.URL, r.Method
 
+	if m.auditSink != nil {
+		m.requestID = rm.requestID(r)
+	}
+
+	return m, nil
+}
+
+// migrateResponseHeader migrates the header of a response whose body isn't
+// migrated, e.g. an empty one, from the current version back to from.
+func (rm *RequestMigration) migrateResponseHeader(r *http.Request, from *Version, status int, header http.Header, handler string) (http.Header, error) {
+	m, err := rm.responseMigrator(r, from, status)
+	if err != nil {
+		return nil, err
+	}
+	m.headerOnly = true
+
+	startTime := rm.clock.Now()
+	defer rm.observeLatency(DirectionResponse, m, rm.getCurrentVersion(), from, startTime)
+
+	_, header, err = m.applyResponseMigrations(r.Context(), []byte{}, header, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// migrateResponse migrates the response body from the current version back
+// to from.
+func (rm *RequestMigration) migrateResponse(r *http.Request, from *Version, status int, body []byte, header http.Header, handler string) ([]byte, http.Header, error) {
 	to := rm.getCurrentVersion()
-	m, err := Newmigrator(from, to, rm.versions, rm.migrations)
+	m, err := rm.responseMigrator(r, from, status)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startTime := rm.clock.Now()
+	defer rm.observeLatency(DirectionResponse, m, to, from, startTime)
+
+	message, err := rm.unwrapEnvelope(body)
+	if errors.Is(err, ErrNoMessage) {
+		return body, header, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, header, err = m.applyResponseMigrations(r.Context(), message, header, handler)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err = rm.wrapEnvelope(body, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, header, nil
+}
+
+// responseVersion returns the version the response to r must be migrated
+// to, or nil when it doesn't need migrating.
+func (rm *RequestMigration) responseVersion(r *http.Request, handler string) (*Version, error) {
+	if !rm.hasMigrations() || rm.isExcluded(handler) {
+		return nil, nil
+	}
+
+	from, err := rm.getDirectionVersion(r, rm.opts.ResponseVersionFunc)
 	if err != nil {
 		return nil, err
 	}
 
-	if from.Equal(to) {
-		return body, nil
+	if from.Equal(rm.getCurrentVersion()) {
+		return nil, nil
+	}
+
+	if !rm.isKnownVersion(from) {
+		return nil, ErrUnknownVersion
 	}
 
-	return m.applyResponseMigrations(r, r.Header, body, handler)
+	return from, nil
+}
+
+func (rm *RequestMigration) unwrapEnvelope(data []byte) ([]byte, error) {
+	if rm.envelope == nil {
+		return data, nil
+	}
+
+	return rm.envelope.Unwrap(data)
+}
+
+func (rm *RequestMigration) wrapEnvelope(original, message []byte) ([]byte, error) {
+	if rm.envelope == nil {
+		return message, nil
+	}
+
+	return rm.envelope.Wrap(original, message)
 }
 
 func (rm *RequestMigration) getUserVersion(req *http.Request) (*Version, error) {
-	var vh string
-	vh = req.Header.Get(rm.opts.VersionHeader)
+	if v, ok := rm.getTenantVersion(req); ok {
+		return v, nil
+	}
 
-	if !isStringEmpty(vh) {
-		return &Version{
-			Format: rm.opts.VersionFormat,
-			Value:  vh,
-		}, nil
+	return rm.resolveVersion(req)
+}
+
+// resolveVersion retrieves the user's version from the resolver chain,
+// falling back to the default version.
+func (rm *RequestMigration) resolveVersion(req *http.Request) (*Version, error) {
+	if rm.isPreview(req) {
+		return rm.latestVersion(), nil
+	}
+
+	if rm.opts.RejectEmptyVersionHeader && hasEmptyHeader(req, rm.opts.VersionHeader) {
+		return nil, fmt.Errorf("%w: %s is empty", ErrInvalidVersion, rm.opts.VersionHeader)
 	}
 
-	if rm.opts.GetUserVersionFunc != nil {
-		vh, err := rm.opts.GetUserVersionFunc(req)
+	for _, resolve := range rm.resolvers {
+		vh, err := resolve(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if isStringEmpty(vh) {
+			continue
+		}
+
+		vh, err = rm.negotiateVersion(vh)
 		if err != nil {
 			return nil, err
 		}
 
-		return &Version{
-			Format: rm.opts.VersionFormat,
-			Value:  vh,
-		}, nil
+		return rm.resolvedVersion(vh), nil
 	}
 
-	return &Version{
-		Format: rm.opts.VersionFormat,
-		Value:  rm.iv,
-	}, nil
+	fv := rm.fallbackVersion(req)
+	if fv != rm.iv && rm.versionIndex(fv) < 0 {
+		return nil, ErrInvalidVersion
+	}
+
+	return rm.resolvedVersion(fv), nil
+}
+
+// getTenantVersion retrieves the version the request's tenant is pinned to,
+// if any.
+func (rm *RequestMigration) getTenantVersion(req *http.Request) (*Version, bool) {
+	if rm.opts.TenantVersionFunc == nil {
+		return nil, false
+	}
+
+	vh, ok := rm.opts.TenantVersionFunc(req)
+	if !ok {
+		return nil, false
+	}
+
+	return rm.resolvedVersion(vh), true
+}
+
+// getDirectionVersion retrieves the user's version using fn, falling back to
+// the resolver chain when fn is nil or returns an empty version. A tenant's
+// pinned version takes precedence over both.
+func (rm *RequestMigration) getDirectionVersion(req *http.Request, fn GetUserVersionFunc) (*Version, error) {
+	if v, ok := rm.getTenantVersion(req); ok {
+		return v, nil
+	}
+
+	if fn == nil {
+		return rm.resolveVersion(req)
+	}
+
+	vh, err := fn(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if isStringEmpty(vh) {
+		return rm.resolveVersion(req)
+	}
+
+	return rm.resolvedVersion(vh), nil
 }
 
 func (rm *RequestMigration) WriteVersionHeader() func(next http.Handler) http.Handler {
@@ -251,6 +1046,7 @@ func (rm *RequestMigration) WriteVersionHeader() func(next http.Handler) http.Ha
 			if err != nil {
 				// fail silently
 				next.ServeHTTP(w, r)
+				return
 			}
 
 			w.Header().Set(rm.opts.VersionHeader, version.String())
@@ -259,21 +1055,78 @@ func (rm *RequestMigration) WriteVersionHeader() func(next http.Handler) http.Ha
 	}
 }
 
-func (rm *RequestMigration) getCurrentVersion() *Version {
-	return &Version{
-		Format: rm.opts.VersionFormat,
-		Value:  rm.opts.CurrentVersion,
+// isKnownVersion reports whether v is the initial version or a registered
+// one. Payloads on other versions can't be migrated.
+func (rm *RequestMigration) isKnownVersion(v *Version) bool {
+	return v.String() == rm.iv || rm.versionIndex(v.String()) >= 0
+}
+
+// hasMigrations checks if any version besides the initial version has been
+// registered.
+func (rm *RequestMigration) hasMigrations() bool {
+	return len(rm.migrations) > 1
+}
+
+// SetCurrentVersion promotes the registered version v to the current version,
+// e.g. on a config reload, without rebuilding the RequestMigration. Requests
+// already being migrated finish with the previous current version.
+func (rm *RequestMigration) SetCurrentVersion(v string) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.indexOf(v) < 0 {
+		return ErrInvalidVersion
 	}
+
+	rm.opts.CurrentVersion = v
+	rm.current = rm.newVersion(v)
+	return nil
 }
 
-func (rm *RequestMigration) observeRequestLatency(from, to *Version, sT time.Time) {
-	finishTime := time.Now()
+// versionFormat returns the format of the version v.
+func (rm *RequestMigration) versionFormat(v string) VersionFormat {
+	if rm.opts.VersionFormatFunc != nil && v != rm.iv {
+		return rm.opts.VersionFormatFunc(v)
+	}
+
+	return rm.opts.VersionFormat
+}
+
+// newVersion returns the version v in its format.
+func (rm *RequestMigration) newVersion(v string) *Version {
+	return &Version{Format: rm.versionFormat(v), Value: v}
+}
+
+// resolvedVersion returns the version v a request resolved to. Most requests
+// are on the current version, which is shared rather than allocated again, so
+// callers must not modify it.
+func (rm *RequestMigration) resolvedVersion(v string) *Version {
+	if current := rm.getCurrentVersion(); current.Value == v {
+		return current
+	}
+
+	return rm.newVersion(v)
+}
+
+// getCurrentVersion returns the current version. It's shared, so callers
+// must not modify it.
+func (rm *RequestMigration) getCurrentVersion() *Version {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.current
+}
+
+func (rm *RequestMigration) observeLatency(direction Direction, m *migrator, from, to *Version, sT time.Time) {
+	finishTime := rm.clock.Now()
 	latency := finishTime.Sub(sT)
 
-	h, err := rm.metric.GetMetricWith(
-		prometheus.Labels{
-			"from": from.String(),
-			"to":   to.String()})
+	labels := prometheus.Labels(m.metricLabels(rm.opts.MetricLabels))
+	labels["from"] = from.String()
+	labels["to"] = to.String()
+	labels["direction"] = string(direction)
+
+	h, err := rm.metric.GetMetricWith(labels)
 	if err != nil {
 		// do nothing.
 		return
@@ -287,6 +1140,20 @@ func (rm *RequestMigration) RegisterMetrics(reg *prometheus.Registry) {
 }
 
 func (rm *RequestMigration) writeResponseToClient(w http.ResponseWriter, res *response) error {
+	// res.header holds the complete, possibly migrated, response header.
+	if res.header != nil {
+		wh := w.Header()
+		for k := range wh {
+			if _, ok := res.header[k]; !ok {
+				delete(wh, k)
+			}
+		}
+
+		for k, v := range res.header {
+			wh[k] = v
+		}
+	}
+
 	if res.statusCode != 0 {
 		w.WriteHeader(res.statusCode)
 	}
@@ -301,10 +1168,80 @@ func (rm *RequestMigration) writeResponseToClient(w http.ResponseWriter, res *re
 }
 
 type migrator struct {
-	to         *Version
-	from       *Version
-	versions   []*Version
-	migrations MigrationStore
+	to          *Version
+	from        *Version
+	versions    []*Version
+	migrations  MigrationStore
+	featureGate FeatureGate
+	auditSink   AuditSink
+	requestID   string
+	timeout     time.Duration
+	clock       Clock
+	labels      map[string][]string
+
+	// status is the status code of the response being migrated, zero when
+	// it's unknown.
+	status int
+
+	// ahead is set when the client's version is newer than the current
+	// version, in which case from and to are swapped so from is the older.
+	ahead bool
+
+	// constrained are the migrations registered with RegisterConstraint
+	// that apply to the client's version.
+	constrained Migrations
+
+	// url and method are those of the request being migrated, for
+	// ConditionalMigrations.
+	url    *url.URL
+	method string
+
+	// headerOnly is set for payloads without a body, only their header
+	// migrations run.
+	headerOnly bool
+}
+
+// compareVersions is Version.Compare by ordinal, for registered versions.
+func (rm *RequestMigration) compareVersions(v, vv *Version) int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	i, ok := rm.ordinals[v.String()]
+	j, okk := rm.ordinals[vv.String()]
+	if !ok || !okk {
+		return v.Compare(vv)
+	}
+
+	return compareInts(i, j)
+}
+
+// newMigrator builds a migrator between from and to configured with rm's
+// options.
+func (rm *RequestMigration) newMigrator(from, to *Version) (*migrator, error) {
+	// chains run from the older version to the newer one, clients ahead of
+	// the current version are migrated along it backwards.
+	ahead := from.IsValid() && to.IsValid() && rm.compareVersions(from, to) > 0
+	if ahead {
+		from, to = to, from
+	}
+
+	m, err := Newmigrator(from, to, rm.versions, rm.migrations)
+	if err != nil {
+		return nil, err
+	}
+	m.ahead = ahead
+
+	client := from
+	if ahead {
+		client = to
+	}
+	m.constrained = rm.constrainedMigrations(client)
+
+	m.featureGate = rm.opts.FeatureGate
+	m.auditSink = rm.opts.AuditSink
+	m.timeout = rm.opts.MigrationTimeout
+	m.clock = rm.clock
+	return m, nil
 }
 
 func Newmigrator(from, to *Version, avs []*Version, migrations MigrationStore) (*migrator, error) {
@@ -320,6 +1257,14 @@ func Newmigrator(from, to *Version, avs []*Version, migrations MigrationStore) (
 		}
 	}
 
+	// stop at to, versions registered after it aren't part of the chain.
+	for i, v := range versions {
+		if v.Equal(to) {
+			versions = versions[:i+1]
+			break
+		}
+	}
+
 	return &migrator{
 		to:         to,
 		from:       from,
@@ -328,22 +1273,91 @@ func Newmigrator(from, to *Version, avs []*Version, migrations MigrationStore) (
 	}, nil
 }
 
-func (m *migrator) applyRequestMigrations(req *http.Request, handler string) error {
-	if m.versions == nil {
-		return nil
+// StepCount returns the number of versions between from and to.
+func (m *migrator) StepCount() int {
+	if len(m.versions) == 0 {
+		return 0
+	}
+
+	return len(m.versions) - 1
+}
+
+// applyRequestMigrations migrates a request to the current version. Requests
+// from clients ahead of it, e.g. previewing the next version, are migrated
+// back with the response migrations.
+func (m *migrator) applyRequestMigrations(ctx context.Context, data []byte, header http.Header, handler string) ([]byte, http.Header, error) {
+	if m.ahead {
+		return m.applyResponseChain(ctx, data, header, handler)
+	}
+
+	return m.applyRequestChain(ctx, data, header, handler)
+}
+
+// applyResponseMigrations migrates a response to the client's version.
+// Responses to clients ahead of the current version are migrated forward
+// with the request migrations.
+func (m *migrator) applyResponseMigrations(ctx context.Context, data []byte, header http.Header, handler string) ([]byte, http.Header, error) {
+	if m.ahead {
+		return m.applyRequestChain(ctx, data, header, handler)
 	}
 
-	data, err := io.ReadAll(req.Body)
+	return m.applyResponseChain(ctx, data, header, handler)
+}
+
+func (m *migrator) applyRequestChain(ctx context.Context, data []byte, header http.Header, handler string) ([]byte, http.Header, error) {
+	chain, err := m.requestMigrations(ctx, handler)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	for _, step := range chain {
+		if m.headerOnly && !isHeaderMigration(step.migration) {
+			continue
+		}
+
+		if !m.shouldMigrate(step.migration, DirectionRequest, data) {
+			continue
+		}
+
+		data, header, err = m.migrate(ctx, step.migration, DirectionRequest, data, header)
+		if err != nil {
+			return nil, nil, step.error(handler, DirectionRequest, err)
+		}
+
+		m.record(handler, step, DirectionRequest)
+	}
+
+	return data, header, nil
+}
+
+// migrationStep is a migration in a chain along with the versions it
+// migrates a payload between.
+type migrationStep struct {
+	from, to  *Version
+	migration Migration
+}
+
+// error wraps err, returned by the step's migration, in a MigrationError.
+func (s migrationStep) error(handler string, direction Direction, err error) error {
+	return &MigrationError{
+		From:          s.from.String(),
+		To:            s.to.String(),
+		Handler:       handler,
+		Direction:     direction,
+		MigrationName: migrationName(s.migration),
+		Err:           err,
 	}
+}
 
-	header := req.Header.Clone()
+// requestMigrations returns the handler's request migrations between from
+// and to, in the order they should be applied.
+func (m *migrator) requestMigrations(ctx context.Context, handler string) ([]migrationStep, error) {
+	var chain []migrationStep
 
-	for _, version := range m.versions {
+	for i, version := range m.versions {
 		migrations, ok := m.migrations[version.String()]
 		if !ok {
-			return ErrInvalidVersion
+			return nil, ErrInvalidVersion
 		}
 
 		// skip initial version.
@@ -352,24 +1366,57 @@ func (m *migrator) applyRequestMigrations(req *http.Request, handler string) err
 		}
 
 		migration := m.retrieveHandlerRequestMigration(migrations, handler)
-		if migration != nil {
-			data, header, err = migration.Migrate(data, header)
-			if err != nil {
-				return err
-			}
+		if migration != nil && m.isEnabled(ctx, migration) {
+			chain = append(chain, migrationStep{from: m.versions[i-1], to: version, migration: migration})
+		}
+	}
+
+	// the request chain runs away from the client, unless it's ahead.
+	if step, ok := m.constrainedStep(ctx, handler, DirectionRequest); ok {
+		if m.ahead {
+			chain = append(chain, step)
+		} else {
+			chain = append([]migrationStep{step}, chain...)
 		}
 	}
 
-	req.Header = header
+	return chain, nil
+}
 
-	// set the body back for the rest of the middleware.
-	req.Body = io.NopCloser(bytes.NewReader(data))
+func (m *migrator) applyResponseChain(ctx context.Context, data []byte, header http.Header, handler string) ([]byte, http.Header, error) {
+	chain, err := m.responseMigrations(ctx, handler)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return nil
+	for _, step := range chain {
+		if m.headerOnly && !isHeaderMigration(step.migration) {
+			continue
+		}
+
+		if !m.shouldMigrate(step.migration, DirectionResponse, data) {
+			continue
+		}
+
+		data, header, err = m.migrate(ctx, step.migration, DirectionResponse, data, header)
+		if err != nil {
+			if !errors.Is(err, ErrMigrationTimeout) && !errors.Is(err, ErrMigrationReturnedNilBody) {
+				err = fmt.Errorf("%w: %w", ErrServerError, err)
+			}
+
+			return nil, nil, step.error(handler, DirectionResponse, err)
+		}
+
+		m.record(handler, step, DirectionResponse)
+	}
+
+	return data, header, nil
 }
 
-func (m *migrator) applyResponseMigrations(r *http.Request, header http.Header, data []byte, handler string) ([]byte, error) {
-	var err error
+// responseMigrations returns the handler's response migrations between to and
+// from, in the order they should be applied.
+func (m *migrator) responseMigrations(ctx context.Context, handler string) ([]migrationStep, error) {
+	var chain []migrationStep
 
 	for i := len(m.versions); i > 0; i-- {
 		version := m.versions[i-1]
@@ -380,45 +1427,98 @@ func (m *migrator) applyResponseMigrations(r *http.Request, header http.Header,
 
 		// skip initial version.
 		if m.from.Equal(version) {
-			return data, nil
+			break
 		}
 
 		migration := m.retrieveHandlerResponseMigration(migrations, handler)
-		if migration != nil {
-			data, _, err = migration.Migrate(data, header)
-			if err != nil {
-				return nil, ErrServerError
-			}
+		if migration != nil && m.isEnabled(ctx, migration) && appliesToStatus(migration, m.status) {
+			chain = append(chain, migrationStep{from: version, to: m.versions[i-2], migration: migration})
 		}
+	}
+
+	// the response chain runs towards the client, unless it's ahead.
+	if step, ok := m.constrainedStep(ctx, handler, DirectionResponse); ok {
+		if m.ahead {
+			chain = append([]migrationStep{step}, chain...)
+		} else {
+			chain = append(chain, step)
+		}
+	}
 
+	return chain, nil
+}
+
+// isEnabled consults the migrations disabled on ctx and the feature gate, if
+// any, to check if migration should run.
+func (m *migrator) isEnabled(ctx context.Context, migration Migration) bool {
+	name := migrationName(migration)
+	if _, ok := disabledMigrations(ctx)[name]; ok {
+		return false
+	}
+
+	if m.featureGate == nil {
+		return true
 	}
 
-	return data, nil
+	return m.featureGate(ctx, name)
 }
 
 func (m *migrator) retrieveHandlerResponseMigration(migrations Migrations, handler string) Migration {
-	return m.retrieveHandlerMigration(migrations, strings.Join([]string{handler, "response"}, ""))
+	return m.retrieveHandlerMigration(migrations, handler, DirectionResponse)
 }
 
 func (m *migrator) retrieveHandlerRequestMigration(migrations Migrations, handler string) Migration {
-	return m.retrieveHandlerMigration(migrations, strings.Join([]string{handler, "request"}, ""))
+	return m.retrieveHandlerMigration(migrations, handler, DirectionRequest)
 }
 
-func (m *migrator) retrieveHandlerMigration(migrations Migrations, handler string) Migration {
+func (m *migrator) retrieveHandlerMigration(migrations Migrations, handler string, direction Direction) Migration {
 	for _, migration := range migrations {
-		var mv reflect.Value
+		fName := strings.ToLower(migrationName(migration))
+		_, directional := asDirectional(migration)
 
-		mv = reflect.ValueOf(migration)
+		if hp, ok := unwrapMigration(migration).(HandlerPattern); ok {
+			if !hp.HandlerPattern().MatchString(handler) {
+				continue
+			}
+
+			if directional || strings.Contains(fName, string(direction)) || isUndirectedHeaderMigration(migration, fName) {
+				return migration
+			}
 
-		if mv.Kind() == reflect.Ptr {
-			mv = mv.Elem()
+			continue
+		}
+
+		prefix := strings.ToLower(handler)
+		if !strings.HasPrefix(fName, prefix) {
+			continue
 		}
 
-		fName := strings.ToLower(mv.Type().Name())
-		if strings.HasPrefix(fName, strings.ToLower(handler)) {
+		if directional || strings.HasPrefix(fName[len(prefix):], string(direction)) || isUndirectedHeaderMigration(migration, fName[len(prefix):]) {
 			return migration
 		}
 	}
 
 	return nil
 }
+
+// namedMigration is implemented by migrations whose type doesn't identify
+// them, e.g. those built by RegisterFunc.
+type namedMigration interface {
+	migrationName() string
+}
+
+// migrationName returns the name of migration's type, which identifies the
+// handler and direction it applies to.
+func migrationName(migration Migration) string {
+	if nm, ok := unwrapMigration(migration).(namedMigration); ok {
+		return nm.migrationName()
+	}
+
+	mv := reflect.ValueOf(unwrapMigration(migration))
+
+	if mv.Kind() == reflect.Ptr {
+		mv = mv.Elem()
+	}
+
+	return mv.Type().Name()
+}
@@ -2,14 +2,28 @@ package requestmigrations
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
+	"log"
+	"math/rand"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -341,3 +355,4760 @@ func Test_VersionResponse(t *testing.T) {
 		})
 	}
 }
+
+func Test_MigrateBatch(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	items := []VersionedPayload{
+		{
+			Version: "2023-02-01",
+			Handler: "createUser",
+			Body:    []byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`),
+		},
+		{
+			Version: "2023-03-01",
+			Handler: "createUser",
+			Body:    []byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`),
+		},
+		{
+			Version: "2023-02-01",
+			Handler: "createUser",
+			Body:    []byte(`{"email":"ops@getconvoy.io","full_name":"Convoy Ops"}`),
+		},
+	}
+
+	bodies, err := rm.MigrateBatch(items)
+	require.NoError(t, err)
+	require.Len(t, bodies, len(items))
+
+	expected := []user{
+		{Email: "engineering@getconvoy.io", FirstName: "Convoy", LastName: "Engineering"},
+		{Email: "engineering@getconvoy.io", FirstName: "Convoy", LastName: "Engineering"},
+		{Email: "ops@getconvoy.io", FirstName: "Convoy", LastName: "Ops"},
+	}
+
+	for i, body := range bodies {
+		var u user
+		err := json.Unmarshal(body, &u)
+		require.NoError(t, err)
+		require.Equal(t, expected[i], u)
+	}
+
+	_, err = rm.MigrateBatch([]VersionedPayload{{Version: "not-a-date"}})
+	require.ErrorIs(t, err, ErrInvalidVersion)
+
+	// versions that parse but aren't registered can't be migrated.
+	_, err = rm.MigrateBatch([]VersionedPayload{{Version: "2023-02-15", Handler: "createUser", Body: []byte(`{"a":1}`)}})
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
+
+type syncAuditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (a *syncAuditLog) Record(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = append(a.entries, entry)
+}
+
+// Test_MigrateBatchParallel is meant to be run with -race too.
+func Test_MigrateBatchParallel(t *testing.T) {
+	sink := &syncAuditLog{}
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		AuditSink:      sink,
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	var items []VersionedPayload
+	var expected []string
+	for i := 0; i < 100; i++ {
+		email := fmt.Sprintf("user%d@getconvoy.io", i)
+
+		switch i % 3 {
+		case 0:
+			items = append(items, VersionedPayload{
+				Version: "2023-02-01",
+				Handler: "createUser",
+				Body:    []byte(fmt.Sprintf(`{"email":%q,"full_name":"Convoy Engineering"}`, email)),
+			})
+			expected = append(expected, fmt.Sprintf(`{"email":%q,"first_name":"Convoy","last_name":"Engineering"}`, email))
+
+		case 1:
+			body := fmt.Sprintf(`{"email":%q,"first_name":"Convoy","last_name":"Engineering"}`, email)
+			items = append(items, VersionedPayload{Version: "2023-03-01", Handler: "createUser", Body: []byte(body)})
+			expected = append(expected, body)
+
+		case 2:
+			// getUser has no request migrations.
+			body := fmt.Sprintf(`{"email":%q,"full_name":"Convoy Engineering"}`, email)
+			items = append(items, VersionedPayload{Version: "2023-02-01", Handler: "getUser", Body: []byte(body)})
+			expected = append(expected, body)
+		}
+	}
+
+	for _, concurrency := range []int{0, 1, 8, 1000} {
+		bodies, err := rm.MigrateBatchParallel(items, concurrency)
+		require.NoError(t, err)
+		require.Len(t, bodies, len(items))
+
+		for i, body := range bodies {
+			require.JSONEq(t, expected[i], string(body))
+		}
+	}
+
+	require.Len(t, sink.entries, 4*34)
+
+	_, err = rm.MigrateBatchParallel([]VersionedPayload{{Version: "not-a-date"}}, 4)
+	require.ErrorIs(t, err, ErrInvalidVersion)
+
+	_, err = rm.MigrateBatchParallel([]VersionedPayload{{Version: "2023-02-15", Handler: "createUser"}}, 4)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+
+	bodies, err := rm.MigrateBatchParallel(nil, 4)
+	require.NoError(t, err)
+	require.Empty(t, bodies)
+}
+
+func Test_VersionResponse_NonJSONBody(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	page := "<html><body><h1>Internal Server Error</h1></body></html>"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "getUser")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		vw.SetHeader(http.StatusInternalServerError)
+		vw.Write([]byte(page))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, page, rr.Body.String())
+}
+
+func Test_VersionResolvers(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		VersionResolvers: []VersionResolver{
+			QueryResolver("version"),
+			CookieResolver("version"),
+			HeaderResolver("X-Test-Version"),
+			FuncResolver(func(req *http.Request) (string, error) {
+				return req.Header.Get("X-Fallback-Version"), nil
+			}),
+		},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		setup    func(req *http.Request)
+		expected string
+	}{
+		"query_takes_precedence": {
+			setup: func(req *http.Request) {
+				req.URL.RawQuery = "version=2023-01-01"
+				req.AddCookie(&http.Cookie{Name: "version", Value: "2023-02-01"})
+				req.Header.Set("X-Test-Version", "2023-03-01")
+			},
+			expected: "2023-01-01",
+		},
+		"cookie_before_header": {
+			setup: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "version", Value: "2023-02-01"})
+				req.Header.Set("X-Test-Version", "2023-03-01")
+			},
+			expected: "2023-02-01",
+		},
+		"header": {
+			setup: func(req *http.Request) {
+				req.Header.Set("X-Test-Version", "2023-03-01")
+			},
+			expected: "2023-03-01",
+		},
+		"func": {
+			setup: func(req *http.Request) {
+				req.Header.Set("X-Fallback-Version", "2022-12-01")
+			},
+			expected: "2022-12-01",
+		},
+		"initial_version": {
+			setup:    func(req *http.Request) {},
+			expected: rm.iv,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			tc.setup(req)
+
+			v, err := rm.getUserVersion(req)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, v.String())
+		})
+	}
+}
+
+func Test_PathVersionPattern(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:      "X-Test-Version",
+		CurrentVersion:     "v3",
+		VersionFormat:      SemverFormat,
+		PathVersionPattern: `^/v(\d+)/`,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"v2": Migrations{},
+		"v3": Migrations{},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/users", nil)
+	v, err := rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, "2", v.String())
+	require.True(t, rm.isKnownVersion(v))
+	require.True(t, v.Equal(rm.newVersion("v2")))
+
+	// the header takes precedence over the path.
+	req.Header.Set("X-Test-Version", "v3")
+	v, err = rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, "v3", v.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/users", nil)
+	v, err = rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, rm.iv, v.String())
+
+	_, err = NewRequestMigration(&RequestMigrationOptions{
+		CurrentVersion:     "v3",
+		VersionFormat:      SemverFormat,
+		PathVersionPattern: `^/v\d+/`,
+	})
+	require.Error(t, err)
+}
+
+func Test_Ordinal(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{},
+		"2023-01-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	o, ok := rm.Ordinal("2023-01-01")
+	require.True(t, ok)
+	require.Equal(t, 1, o)
+
+	o, ok = rm.Ordinal("2023-03-01")
+	require.True(t, ok)
+	require.Equal(t, 2, o)
+
+	// registering an older version shifts the ordinals of newer ones.
+	err = rm.RegisterMigrations(MigrationStore{
+		"2022-12-01": Migrations{},
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	var ordinals []int
+	for _, v := range []string{"2022-12-01", "2023-01-01", "2023-02-01", "2023-03-01"} {
+		o, ok := rm.Ordinal(v)
+		require.True(t, ok)
+		ordinals = append(ordinals, o)
+	}
+	require.Equal(t, []int{1, 2, 3, 4}, ordinals)
+
+	_, ok = rm.Ordinal(rm.iv)
+	require.False(t, ok)
+
+	_, ok = rm.Ordinal("2023-04-01")
+	require.False(t, ok)
+
+	require.Equal(t, 1, rm.compareVersions(rm.newVersion("2023-03-01"), rm.newVersion("2023-01-01")))
+	require.Equal(t, -1, rm.compareVersions(rm.newVersion("2023-02-01"), rm.newVersion("2023-04-01")))
+}
+
+func Test_DirectionVersionFuncs(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		ResponseVersionFunc: func(req *http.Request) (string, error) {
+			return req.Header.Get("X-Session-Version"), nil
+		},
+	})
+	require.NoError(t, err)
+
+	registerBasicMigrations(t, rm)
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	body := strings.NewReader(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+	req := httptest.NewRequest(http.MethodPost, "/users", body)
+	req.Header.Set("X-Test-Version", "2023-03-01")
+	req.Header.Set("X-Session-Version", "2023-02-01")
+
+	rr := httptest.NewRecorder()
+	createUser(t, rm).ServeHTTP(rr, req)
+
+	var u oldUser
+	err = json.Unmarshal(rr.Body.Bytes(), &u)
+	require.NoError(t, err)
+	require.Equal(t, "Convoy Engineering", u.FullName)
+}
+
+func Test_OnVersionResolved(t *testing.T) {
+	var resolved []string
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		OnVersionResolved: func(req *http.Request, v *Version) {
+			resolved = append(resolved, v.String())
+		},
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
+	req.Header.Set("X-Test-Version", "2023-03-01")
+
+	rr := httptest.NewRecorder()
+	getUser(t, rm).ServeHTTP(rr, req)
+
+	require.Equal(t, []string{"2023-03-01"}, resolved)
+}
+
+func connectFrame(message []byte) []byte {
+	frame := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+	copy(frame[5:], message)
+	return frame
+}
+
+func Test_ConnectEnvelopeCodec(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		EnvelopeCodec:  ConnectEnvelopeCodec{},
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	endStream := append([]byte{2, 0, 0, 0, 2}, "{}"...)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "createUser")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		payload, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		message, err := ConnectEnvelopeCodec{}.Unwrap(payload)
+		require.NoError(t, err)
+
+		var u user
+		err = json.Unmarshal(message, &u)
+		require.NoError(t, err)
+		require.Equal(t, "Convoy", u.FirstName)
+
+		w.Header().Set("Content-Type", "application/connect+json")
+		vw.Write(append(connectFrame(message), endStream...))
+	})
+
+	body := connectFrame([]byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`))
+	body = append(body, endStream...)
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/connect+json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	message, err := ConnectEnvelopeCodec{}.Unwrap(rr.Body.Bytes())
+	require.NoError(t, err)
+
+	var u oldUser
+	err = json.Unmarshal(message, &u)
+	require.NoError(t, err)
+	require.Equal(t, "Convoy Engineering", u.FullName)
+	require.True(t, bytes.HasSuffix(rr.Body.Bytes(), endStream))
+
+	_, err = ConnectEnvelopeCodec{}.Unwrap([]byte{1, 0, 0, 0, 0})
+	require.ErrorIs(t, err, ErrCompressedEnvelope)
+
+	_, err = ConnectEnvelopeCodec{}.Unwrap([]byte{0, 0, 0, 0, 9, '{'})
+	require.ErrorIs(t, err, ErrInvalidEnvelope)
+
+	_, err = ConnectEnvelopeCodec{}.Unwrap(endStream)
+	require.ErrorIs(t, err, ErrNoMessage)
+
+	payload := append(connectFrame([]byte(`{"a":1}`)), connectFrame([]byte(`{"b":2}`))...)
+	_, err = ConnectEnvelopeCodec{}.Unwrap(payload)
+	require.ErrorIs(t, err, ErrInvalidEnvelope)
+}
+
+type listUsersResponseTotalCountMigration struct{}
+
+func (l *listUsersResponseTotalCountMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	var users []user
+	err := json.Unmarshal(body, &users)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h.Set("X-Total-Count", strconv.Itoa(len(users)))
+	h.Del("X-Next-Cursor")
+
+	return body, h, nil
+}
+
+func Test_VersionResponse_Header(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&listUsersResponseTotalCountMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "listUsers")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		body, err := json.Marshal([]user{{Email: "engineering@getconvoy.io"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Next-Cursor", "abc")
+		vw.Write(body)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, "1", rr.Header().Get("X-Total-Count"))
+	require.Empty(t, rr.Header().Get("X-Next-Cursor"))
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+}
+
+func Test_VersionResponse_ContentLength(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "getUser")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer rollback(w)
+
+		body := []byte(`{"email":"a@b.c","first_name":"Convoy","last_name":"Engineering"}`)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		vw.Write(body)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"email":"a@b.c","full_name":"Convoy Engineering"}`, string(body))
+	require.Equal(t, int64(len(body)), resp.ContentLength)
+}
+
+type getProfileRequestAuthHeaderMigration struct{}
+
+func (g *getProfileRequestAuthHeaderMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	if token := h.Get("X-Auth-Token"); !isStringEmpty(token) {
+		h.Set("Authorization", "Bearer "+token)
+		h.Del("X-Auth-Token")
+	}
+
+	return body, h, nil
+}
+
+func Test_VersionRequest_Header(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&getProfileRequestAuthHeaderMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	var authorization, token string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, _, rollback := rm.Migrate(r, "getProfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		authorization = r.Header.Get("Authorization")
+		token = r.Header.Get("X-Auth-Token")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/profile", strings.NewReader(""))
+	req.Header.Set("X-Auth-Token", "secret")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, "Bearer secret", authorization)
+	require.Empty(t, token)
+}
+
+func Test_VersionRequest_Idempotent(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, _, _ := rm.Migrate(r, "createUser")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		createUser(t, rm).ServeHTTP(w, r)
+	})
+
+	body := strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	req := httptest.NewRequest(http.MethodPost, "/users", body)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var u oldUser
+	err := json.Unmarshal(rr.Body.Bytes(), &u)
+	require.NoError(t, err)
+	require.Equal(t, "Convoy Engineering", u.FullName)
+}
+
+func Test_WriteVersionHeader(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:            "X-Test-Version",
+		CurrentVersion:           "2023-03-01",
+		VersionFormat:            DateFormat,
+		RejectEmptyVersionHeader: true,
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	tests := map[string]struct {
+		version  string
+		expected string
+	}{
+		"registered": {
+			version:  "2023-03-01",
+			expected: "2023-03-01",
+		},
+		"unknown": {
+			version: "2020-01-01, 2020-02-01",
+		},
+		"empty": {
+			version: " ",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var called bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("X-Test-Version", tc.version)
+
+			rr := httptest.NewRecorder()
+			rm.WriteVersionHeader()(next).ServeHTTP(rr, req)
+
+			require.True(t, called)
+			require.Equal(t, tc.expected, rr.Header().Get("X-Test-Version"))
+		})
+	}
+}
+
+type uploadAvatarRequestRenameFieldsMigration struct{}
+
+func (u *uploadAvatarRequestRenameFieldsMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return body, h, nil
+}
+
+func (u *uploadAvatarRequestRenameFieldsMigration) MigrateForm(form *multipart.Form) error {
+	form.Value["email"] = form.Value["username"]
+	delete(form.Value, "username")
+
+	form.File["picture"] = form.File["avatar"]
+	delete(form.File, "avatar")
+
+	return nil
+}
+
+func Test_VersionRequest_MultipartForm(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&uploadAvatarRequestRenameFieldsMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("username", "engineering@getconvoy.io"))
+	fw, err := mw.CreateFormFile("avatar", "avatar.png")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("png-bytes"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, _, rollback := rm.Migrate(r, "uploadAvatar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		err = r.ParseMultipartForm(maxFormMemory)
+		require.NoError(t, err)
+
+		require.Equal(t, "engineering@getconvoy.io", r.FormValue("email"))
+		require.Empty(t, r.FormValue("username"))
+
+		f, fh, err := r.FormFile("picture")
+		require.NoError(t, err)
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "avatar.png", fh.Filename)
+		require.Equal(t, "png-bytes", string(data))
+
+		_, _, err = r.FormFile("avatar")
+		require.ErrorIs(t, err, http.ErrMissingFile)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/avatar", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+}
+
+type receiveWebhookRequestRenameFieldsMigration struct{}
+
+func (rw *receiveWebhookRequestRenameFieldsMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return body, h, nil
+}
+
+func (rw *receiveWebhookRequestRenameFieldsMigration) MigrateValues(v url.Values) (url.Values, error) {
+	v["event_type"] = v["event"]
+	v.Del("event")
+
+	return v, nil
+}
+
+func Test_VersionRequest_URLEncodedForm(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&receiveWebhookRequestRenameFieldsMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	var values url.Values
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, _, rollback := rm.Migrate(r, "receiveWebhook")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		err = r.ParseForm()
+		require.NoError(t, err)
+
+		values = r.PostForm
+	})
+
+	form := url.Values{
+		"event": {"user.created"},
+		"id":    {"123", "456"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, url.Values{
+		"event_type": {"user.created"},
+		"id":         {"123", "456"},
+	}, values)
+}
+
+type receiveWebhookRenameEventMigration struct{}
+
+func (rw *receiveWebhookRenameEventMigration) MigrateRequest(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return body, h, nil
+}
+
+func (rw *receiveWebhookRenameEventMigration) MigrateResponse(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return body, h, nil
+}
+
+func (rw *receiveWebhookRenameEventMigration) MigrateValues(v url.Values) (url.Values, error) {
+	v["event_type"] = v["event"]
+	v.Del("event")
+
+	return v, nil
+}
+
+func Test_VersionRequest_URLEncodedForm_Directional(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			Directional(&receiveWebhookRenameEventMigration{}),
+		},
+	})
+	require.NoError(t, err)
+
+	var values url.Values
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, _, rollback := rm.Migrate(r, "receiveWebhook")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		err = r.ParseForm()
+		require.NoError(t, err)
+
+		values = r.PostForm
+	})
+
+	form := url.Values{"event": {"user.created"}}
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, url.Values{"event_type": {"user.created"}}, values)
+}
+
+func BenchmarkMigrate(b *testing.B) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	body := bytes.Repeat([]byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`), 64)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+		req.Header.Set("X-Test-Version", "2023-02-01")
+
+		err, _, rollback := rm.Migrate(req, "createUser")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = io.Copy(io.Discard, req.Body)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		rollback(w)
+		w.Body.Reset()
+	}
+}
+
+func BenchmarkMigrate_NoMigrations(b *testing.B) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	body := []byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+		req.Header.Set("X-Test-Version", "2023-02-01")
+
+		err, vw, rollback := rm.Migrate(req, "createUser")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		vw.Write(body)
+		rollback(w)
+		w.Body.Reset()
+	}
+}
+
+func Test_StepCount(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		version  string
+		expected int
+	}{
+		"current_version": {
+			version:  "2023-03-01",
+			expected: 0,
+		},
+		"previous_version": {
+			version:  "2023-02-01",
+			expected: 1,
+		},
+		"initial_version": {
+			expected: 2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			body := strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+			if tc.version == "2023-03-01" {
+				body = strings.NewReader(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/users", body)
+			if tc.version != "" {
+				req.Header.Set("X-Test-Version", tc.version)
+			}
+
+			rr := httptest.NewRecorder()
+			createUser(t, rm).ServeHTTP(rr, req)
+
+			require.Equal(t, tc.expected, StepCount(req.Context()))
+		})
+	}
+}
+
+func Test_FeatureGate(t *testing.T) {
+	var gated []string
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		FeatureGate: func(ctx context.Context, migrationName string) bool {
+			gated = append(gated, migrationName)
+			return migrationName != "getUserResponseCombineNamesMigration"
+		},
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
+	rr := httptest.NewRecorder()
+	getUser(t, rm).ServeHTTP(rr, req)
+
+	var u user
+	err = json.Unmarshal(rr.Body.Bytes(), &u)
+	require.NoError(t, err)
+	require.Equal(t, "Convoy", u.FirstName)
+	require.Equal(t, []string{"getUserResponseCombineNamesMigration"}, gated)
+}
+
+func Test_WithDisabledMigrations(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	tests := map[string]struct {
+		disabled  []string
+		firstName string
+	}{
+		"none": {
+			firstName: "",
+		},
+		"disabled": {
+			disabled:  []string{"getUserResponseCombineNamesMigration"},
+			firstName: "Convoy",
+		},
+		"other": {
+			disabled:  []string{"createUserRequestSplitNameMigration"},
+			firstName: "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
+			req = req.WithContext(rm.WithDisabledMigrations(req.Context(), tc.disabled...))
+			rr := httptest.NewRecorder()
+			getUser(t, rm).ServeHTTP(rr, req)
+
+			var u user
+			err := json.Unmarshal(rr.Body.Bytes(), &u)
+			require.NoError(t, err)
+			require.Equal(t, tc.firstName, u.FirstName)
+		})
+	}
+
+	// names disabled on a parent context stay disabled.
+	ctx := rm.WithDisabledMigrations(context.Background(), "getUserResponseCombineNamesMigration")
+	ctx = rm.WithDisabledMigrations(ctx, "createUserRequestSplitNameMigration")
+	require.Len(t, disabledMigrations(ctx), 2)
+}
+
+type auditLog struct {
+	entries []AuditEntry
+}
+
+func (a *auditLog) Record(entry AuditEntry) {
+	a.entries = append(a.entries, entry)
+}
+
+func Test_AuditSink(t *testing.T) {
+	sink := &auditLog{}
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		AuditSink:      sink,
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	body := strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	req := httptest.NewRequest(http.MethodPost, "/users", body)
+	req.Header.Set("X-Request-ID", "req_123")
+
+	rr := httptest.NewRecorder()
+	createUser(t, rm).ServeHTTP(rr, req)
+
+	t.Log(sink.entries)
+	require.Len(t, sink.entries, 2)
+	for i, direction := range []Direction{DirectionRequest, DirectionResponse} {
+		entry := sink.entries[i]
+		require.Equal(t, "req_123", entry.RequestID)
+		require.Equal(t, "createUser", entry.Handler)
+		require.Equal(t, direction, entry.Direction)
+		require.False(t, entry.Timestamp.IsZero())
+	}
+
+	// entries record the direction the payload moved in.
+	require.Equal(t, rm.iv, sink.entries[0].From)
+	require.Equal(t, "2023-03-01", sink.entries[0].To)
+	require.Equal(t, "2023-03-01", sink.entries[1].From)
+	require.Equal(t, rm.iv, sink.entries[1].To)
+
+	require.Equal(t, "createUserRequestSplitNameMigration", sink.entries[0].Migration)
+	require.Equal(t, "createUserResponseCombineNamesMigration", sink.entries[1].Migration)
+}
+
+type updateUserResponseErrorEnvelopeMigration struct{}
+
+func (u *updateUserResponseErrorEnvelopeMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	var newErr struct {
+		Errors []struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	err := json.Unmarshal(body, &newErr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var oldErr struct {
+		Error string `json:"error"`
+	}
+	if len(newErr.Errors) > 0 {
+		oldErr.Error = newErr.Errors[0].Detail
+	}
+
+	body, err = json.Marshal(&oldErr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, h, nil
+}
+
+func Test_VersionResponse_ErrorBody(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&updateUserResponseErrorEnvelopeMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "updateUser")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rollback(w)
+
+		w.Header().Set("Content-Type", "application/json")
+		vw.SetHeader(http.StatusUnprocessableEntity)
+		vw.Write([]byte(`{"errors":[{"detail":"email is invalid"}]}`))
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/users/123", strings.NewReader(`{}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	require.JSONEq(t, `{"error":"email is invalid"}`, rr.Body.String())
+}
+
+func Test_MigrationsForHandler(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {
+			"createUserRequestSplitNameMigration",
+			"createUserResponseCombineNamesMigration",
+		},
+	}, rm.MigrationsForHandler("createUser"))
+
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"getUserResponseCombineNamesMigration"},
+	}, rm.MigrationsForHandler("getUser"))
+
+	require.Empty(t, rm.MigrationsForHandler("deleteUser"))
+}
+
+func Test_Validate(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-01-01": Migrations{&getUserResponseCombineNamesMigration{}},
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{&createUserRequestSplitNameMigration{}},
+	})
+	require.NoError(t, err)
+
+	err = rm.Validate()
+	require.ErrorIs(t, err, ErrMigrationGap)
+	require.Contains(t, err.Error(), "2023-02-01")
+
+	rm = newRequestMigration(t)
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-01-01": Migrations{&getUserResponseCombineNamesMigration{}},
+		"2023-02-01": Migrations{&createUserResponseCombineNamesMigration{}},
+		"2023-03-01": Migrations{&createUserRequestSplitNameMigration{}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, rm.Validate())
+}
+
+var usersPattern = regexp.MustCompile(`^users`)
+
+type usersResponseAPIVersionMigration struct{}
+
+func (u *usersResponseAPIVersionMigration) HandlerPattern() *regexp.Regexp {
+	return usersPattern
+}
+
+func (u *usersResponseAPIVersionMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	h.Set("X-Legacy-API", "true")
+	return body, h, nil
+}
+
+func Test_HandlerPattern(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&usersResponseAPIVersionMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]bool{
+		"usersV2":  true,
+		"usersV3":  true,
+		"getUsers": false,
+	}
+
+	for handlerName, migrated := range tests {
+		t.Run(handlerName, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err, vw, rollback := rm.Migrate(r, handlerName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rollback(w)
+
+				vw.Write([]byte(`{}`))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, migrated, rr.Header().Get("X-Legacy-API") == "true")
+		})
+	}
+}
+
+func Test_TenantVersionFunc(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		TenantVersionFunc: func(req *http.Request) (string, bool) {
+			if req.Header.Get("X-Tenant") == "acme" {
+				return "2023-01-01", true
+			}
+
+			return "", false
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Test-Version", "2023-03-01")
+	req.Header.Set("X-Tenant", "acme")
+
+	v, err := rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, "2023-01-01", v.String())
+
+	req.Header.Set("X-Tenant", "globex")
+
+	v, err = rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, "2023-03-01", v.String())
+}
+
+func Test_ExcludeHandler(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+	rm.ExcludeHandler("createUser")
+
+	body := strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	req := httptest.NewRequest(http.MethodPost, "/users", body)
+
+	rr := httptest.NewRecorder()
+	createUser(t, rm).ServeHTTP(rr, req)
+
+	// the request was still migrated, but the response wasn't.
+	var u user
+	err := json.Unmarshal(rr.Body.Bytes(), &u)
+	require.NoError(t, err)
+	require.Equal(t, "Convoy", u.FirstName)
+	require.Equal(t, "Engineering", u.LastName)
+}
+
+type getUserRequestBlockingMigration struct{}
+
+func (g *getUserRequestBlockingMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return body, h, nil
+}
+
+func (g *getUserRequestBlockingMigration) MigrateContext(
+	ctx context.Context,
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	<-ctx.Done()
+	return nil, nil, ctx.Err()
+}
+
+type createUserRequestSlowMigration struct{}
+
+func (c *createUserRequestSlowMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	time.Sleep(100 * time.Millisecond)
+	return body, h, nil
+}
+
+func Test_MigrationTimeout(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:    "X-Test-Version",
+		CurrentVersion:   "2023-03-01",
+		VersionFormat:    DateFormat,
+		MigrationTimeout: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&getUserRequestBlockingMigration{},
+			&createUserRequestSlowMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, handler := range []string{"getUser", "createUser"} {
+		t.Run(handler, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{}`))
+
+			err, _, _ := rm.Migrate(req, handler)
+			require.ErrorIs(t, err, ErrMigrationTimeout)
+		})
+	}
+}
+
+type getUserResponseSlowHeaderMigration struct{}
+
+func (g *getUserResponseSlowHeaderMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	time.Sleep(50 * time.Millisecond)
+	h.Set("X-Late", "true")
+	return body, h, nil
+}
+
+// Test_MigrationTimeout_FailOpen is meant to be run with -race too.
+func Test_MigrationTimeout_FailOpen(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:    "X-Test-Version",
+		CurrentVersion:   "2023-03-01",
+		VersionFormat:    DateFormat,
+		MigrationTimeout: 10 * time.Millisecond,
+		OnMigrationError: FailOpen,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&getUserResponseSlowHeaderMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	rr := httptest.NewRecorder()
+	getUser(t, rm).ServeHTTP(rr, req)
+
+	// let the abandoned migration finish.
+	time.Sleep(100 * time.Millisecond)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Empty(t, rr.Header().Get("X-Late"))
+	require.JSONEq(t, `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`, rr.Body.String())
+}
+
+func Test_FieldState(t *testing.T) {
+	tests := map[string]struct {
+		body    string
+		present bool
+		isNull  bool
+	}{
+		"absent": {
+			body: `{"email":"engineering@getconvoy.io"}`,
+		},
+		"null": {
+			body:    `{"email":"engineering@getconvoy.io","profile":null}`,
+			present: true,
+			isNull:  true,
+		},
+		"valued": {
+			body:    `{"email":"engineering@getconvoy.io","profile":"999"}`,
+			present: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var m map[string]any
+			err := json.Unmarshal([]byte(tc.body), &m)
+			require.NoError(t, err)
+
+			present, isNull := FieldState(m, "profile")
+			require.Equal(t, tc.present, present)
+			require.Equal(t, tc.isNull, isNull)
+
+			// the distinction survives a round trip.
+			body, err := json.Marshal(m)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.body, string(body))
+		})
+	}
+}
+
+func Test_VersionInfoHandler(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/versions", nil)
+	rr := httptest.NewRecorder()
+	rm.VersionInfoHandler().ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	require.JSONEq(t, `{
+		"current": "2023-03-01",
+		"default": "0001-01-01",
+		"supported": ["2023-02-01", "2023-03-01"],
+		"header": "X-Test-Version"
+	}`, rr.Body.String())
+}
+
+func Test_Convert(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-04-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&createUserRequestSplitNameMigration{},
+			&createUserResponseCombineNamesMigration{},
+		},
+		"2023-04-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	oldBody := []byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	newBody := []byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+
+	tests := map[string]struct {
+		from, to string
+		body     []byte
+		expected []byte
+		err      error
+	}{
+		"forward": {
+			from:     "2023-02-01",
+			to:       "2023-03-01",
+			body:     oldBody,
+			expected: newBody,
+		},
+		"backward": {
+			from:     "2023-03-01",
+			to:       "2023-02-01",
+			body:     newBody,
+			expected: oldBody,
+		},
+		"no_change_between_versions": {
+			from:     "2023-03-01",
+			to:       "2023-04-01",
+			body:     newBody,
+			expected: newBody,
+		},
+		"same_version": {
+			from:     "2023-02-01",
+			to:       "2023-02-01",
+			body:     oldBody,
+			expected: oldBody,
+		},
+		"unregistered_version": {
+			from: "2023-02-15",
+			to:   "2023-03-01",
+			body: oldBody,
+			err:  ErrInvalidVersion,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := rm.Convert(tc.from, tc.to, "createUser", tc.body)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.JSONEq(t, string(tc.expected), string(data))
+		})
+	}
+}
+
+type createUserSplitNameMigration struct{}
+
+func (c *createUserSplitNameMigration) MigrateRequest(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return (&createUserRequestSplitNameMigration{}).Migrate(body, h)
+}
+
+func (c *createUserSplitNameMigration) MigrateResponse(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return (&createUserResponseCombineNamesMigration{}).Migrate(body, h)
+}
+
+func Test_DirectionalMigration(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			Directional(&createUserSplitNameMigration{}),
+		},
+	})
+	require.NoError(t, err)
+
+	oldBody := []byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	newBody := []byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+
+	data, err := rm.Convert("2023-02-01", "2023-03-01", "createUser", oldBody)
+	require.NoError(t, err)
+	require.JSONEq(t, string(newBody), string(data))
+
+	data, err = rm.Convert("2023-03-01", "2023-02-01", "createUser", newBody)
+	require.NoError(t, err)
+	require.JSONEq(t, string(oldBody), string(data))
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(oldBody))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	createUser(t, rm).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, string(oldBody), rr.Body.String())
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"createUserSplitNameMigration"},
+	}, rm.MigrationsForHandler("createUser"))
+}
+
+func Test_MixedMigrationStyles(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&getUserResponseCombineNamesMigration{},
+			Directional(&createUserSplitNameMigration{}),
+		},
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterFunc("2023-03-01", "deleteUser", nil, func(data []byte, h http.Header) ([]byte, http.Header, error) {
+		return []byte(`{"deleted":true}`), h, nil
+	})
+	require.NoError(t, err)
+
+	oldBody := []byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	newBody := []byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+
+	data, err := rm.Convert("2023-02-01", "2023-03-01", "createUser", oldBody)
+	require.NoError(t, err)
+	require.JSONEq(t, string(newBody), string(data))
+
+	data, err = rm.Convert("2023-03-01", "2023-02-01", "getUser", newBody)
+	require.NoError(t, err)
+	require.JSONEq(t, string(oldBody), string(data))
+
+	data, err = rm.Convert("2023-03-01", "2023-02-01", "deleteUser", []byte(`{}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"deleted":true}`, string(data))
+}
+
+type createUserRequestSplitNameOnPostMigration struct {
+	createUserRequestSplitNameMigration
+}
+
+func (c *createUserRequestSplitNameOnPostMigration) ShouldMigrateConstraint(
+	url *url.URL,
+	method string,
+	data []byte,
+	isReq bool) bool {
+	return url.Path == "/users" && method == http.MethodPost && isReq &&
+		bytes.Contains(data, []byte("full_name"))
+}
+
+func Test_ConditionalMigration(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&createUserRequestSplitNameOnPostMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	tests := map[string]struct {
+		method   string
+		path     string
+		body     string
+		expected string
+	}{
+		"applied": {
+			method:   http.MethodPost,
+			path:     "/users",
+			body:     oldBody,
+			expected: newBody,
+		},
+		"other_path": {
+			method:   http.MethodPost,
+			path:     "/admins",
+			body:     oldBody,
+			expected: oldBody,
+		},
+		"other_method": {
+			method:   http.MethodPut,
+			path:     "/users",
+			body:     oldBody,
+			expected: oldBody,
+		},
+		"body_already_migrated": {
+			method:   http.MethodPost,
+			path:     "/users",
+			body:     newBody,
+			expected: newBody,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			req.Header.Set("Content-Type", "application/json")
+
+			err, _, _ := rm.Migrate(req, "createUser")
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.expected, string(data))
+		})
+	}
+
+	// Convert has no request to match, so the constraint fails.
+	data, err := rm.Convert("2023-02-01", "2023-03-01", "createUser", []byte(oldBody))
+	require.NoError(t, err)
+	require.JSONEq(t, oldBody, string(data))
+}
+
+type xmlUserCodec struct{}
+
+func (xmlUserCodec) ContentType() string {
+	return "application/xml"
+}
+
+func (xmlUserCodec) Encode(data []byte) ([]byte, error) {
+	var u struct {
+		XMLName  xml.Name `json:"-" xml:"user"`
+		Email    string   `json:"email" xml:"email"`
+		FullName string   `json:"full_name" xml:"full_name"`
+	}
+
+	err := json.Unmarshal(data, &u)
+	if err != nil {
+		return nil, err
+	}
+
+	return xml.Marshal(u)
+}
+
+func Test_ResponseCodecs(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		ResponseCodecs: map[string]ResponseCodec{
+			"2023-02-01": xmlUserCodec{},
+		},
+	})
+	require.NoError(t, err)
+
+	registerBasicMigrations(t, rm)
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	tests := map[string]struct {
+		version     string
+		accept      string
+		body        string
+		contentType string
+		expected    string
+	}{
+		"codec_version": {
+			version:     "2023-02-01",
+			body:        oldBody,
+			contentType: "application/xml",
+			expected:    `<user><email>engineering@getconvoy.io</email><full_name>Convoy Engineering</full_name></user>`,
+		},
+		"codec_version_accepts_any": {
+			version:     "2023-02-01",
+			accept:      "application/*",
+			body:        oldBody,
+			contentType: "application/xml",
+			expected:    `<user><email>engineering@getconvoy.io</email><full_name>Convoy Engineering</full_name></user>`,
+		},
+		"codec_version_accepts_json": {
+			version:  "2023-02-01",
+			accept:   "application/json",
+			body:     oldBody,
+			expected: oldBody,
+		},
+		"current_version": {
+			version:  "2023-03-01",
+			body:     newBody,
+			expected: newBody,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tc.body))
+			req.Header.Set("X-Test-Version", tc.version)
+			req.Header.Set("Content-Type", "application/json")
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			rr := httptest.NewRecorder()
+			createUser(t, rm).ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			if tc.contentType == "" {
+				require.NotEqual(t, "application/xml", rr.Header().Get("Content-Type"))
+				require.JSONEq(t, tc.expected, rr.Body.String())
+				return
+			}
+
+			require.Equal(t, tc.contentType, rr.Header().Get("Content-Type"))
+			require.Equal(t, tc.expected, rr.Body.String())
+		})
+	}
+
+	require.True(t, accepts(http.Header{"Accept": {"text/html, */*;q=0.8"}}, "application/xml"))
+	require.False(t, accepts(http.Header{"Accept": {"application/xml;q=0, application/json"}}, "application/xml"))
+}
+
+func Test_MigrationHooks(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:    "X-Test-Version",
+		CurrentVersion:   "2023-03-01",
+		VersionFormat:    DateFormat,
+		OnMigrationError: FailOpen,
+	})
+	require.NoError(t, err)
+
+	registerBasicMigrations(t, rm)
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	var calls []string
+	rm.AddPreMigrationHook(func(ctx context.Context, v *Version, r *http.Request) error {
+		calls = append(calls, "pre "+v.String())
+		if r.Header.Get("X-Reject") != "" {
+			return errors.New("rejected")
+		}
+
+		r.Header.Set("X-Correlation-ID", "abc")
+		return nil
+	})
+	rm.AddPostMigrationHook(func(ctx context.Context, v *Version, r *http.Request) error {
+		calls = append(calls, "post "+v.String()+" "+r.Header.Get("X-Correlation-ID"))
+		return nil
+	})
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(oldBody))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	rr := httptest.NewRecorder()
+	createUser(t, rm).ServeHTTP(rr, req)
+
+	require.JSONEq(t, oldBody, rr.Body.String())
+	require.Equal(t, []string{"pre 2023-02-01", "post 2023-02-01 abc"}, calls)
+
+	// requests on the current version run the hooks too.
+	calls = nil
+	req = httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(newBody))
+	req.Header.Set("X-Test-Version", "2023-03-01")
+	rr = httptest.NewRecorder()
+	createUser(t, rm).ServeHTTP(rr, req)
+
+	require.JSONEq(t, newBody, rr.Body.String())
+	require.Equal(t, []string{"pre 2023-03-01", "post 2023-03-01 abc"}, calls)
+
+	// as do bodyless requests and responses that aren't migrated, once per
+	// request even when Migrate is called again.
+	calls = nil
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, _, _ := rm.Migrate(r, "deleteUser")
+		require.NoError(t, err)
+
+		err, vw, rollback := rm.Migrate(r, "deleteUser")
+		require.NoError(t, err)
+		defer rollback(w)
+
+		vw.SetHeader(http.StatusNoContent)
+	})
+
+	req = httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusNoContent, rr.Code)
+	require.Equal(t, []string{"pre 2023-02-01", "post 2023-02-01 abc"}, calls)
+
+	// a failing pre-migration hook aborts the request, even when failing open.
+	calls = nil
+	req = httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(oldBody))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	req.Header.Set("X-Reject", "true")
+
+	err, _, _ = rm.Migrate(req, "createUser")
+	require.EqualError(t, err, "rejected")
+	require.Equal(t, []string{"pre 2023-02-01"}, calls)
+}
+
+type createUserRequestRenameTraceHeaderMigration struct{}
+
+func (c *createUserRequestRenameTraceHeaderMigration) MigrateHeader(h http.Header) error {
+	if v := h.Get("X-Trace"); v != "" {
+		h.Del("X-Trace")
+		h.Set("X-Trace-Id", v)
+	}
+
+	return nil
+}
+
+type createUserResponseRenameTraceHeaderMigration struct{}
+
+func (c *createUserResponseRenameTraceHeaderMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return nil, nil, errors.New("MigrateHeader should be called instead")
+}
+
+func (c *createUserResponseRenameTraceHeaderMigration) MigrateHeader(h http.Header) error {
+	if v := h.Get("X-Trace-Id"); v != "" {
+		h.Del("X-Trace-Id")
+		h.Set("X-Trace", v)
+	}
+
+	return nil
+}
+
+func Test_HeaderMigration(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			HeaderOnly(&createUserRequestRenameTraceHeaderMigration{}),
+			&createUserResponseRenameTraceHeaderMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	body := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "createUser")
+		require.NoError(t, err)
+		defer rollback(w)
+
+		require.Equal(t, "abc", r.Header.Get("X-Trace-Id"))
+		require.Empty(t, r.Header.Get("X-Trace"))
+
+		payload, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, body, string(payload))
+
+		w.Header().Set("X-Trace-Id", r.Header.Get("X-Trace-Id"))
+		vw.Write(payload)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	req.Header.Set("X-Trace", "abc")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, body, rr.Body.String())
+	require.Equal(t, "abc", rr.Header().Get("X-Trace"))
+	require.Empty(t, rr.Header().Get("X-Trace-Id"))
+
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"createUserRequestRenameTraceHeaderMigration", "createUserResponseRenameTraceHeaderMigration"},
+	}, rm.MigrationsForHandler("createUser"))
+}
+
+type getUserDeprecationHeaderMigration struct{}
+
+func (g *getUserDeprecationHeaderMigration) MigrateHeader(h http.Header) error {
+	if h.Get("X-Legacy-Client") == "" {
+		h.Set("X-Legacy-Client", "true")
+	} else {
+		h.Set("Deprecation", "true")
+	}
+
+	return nil
+}
+
+func Test_HeaderMigration_BothDirections(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			HeaderOnly(&getUserDeprecationHeaderMigration{}),
+		},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		method string
+		body   []byte
+	}{
+		"get":   {method: http.MethodGet, body: []byte(`{"id":1}`)},
+		"empty": {method: http.MethodGet},
+		"head":  {method: http.MethodHead},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var legacy string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err, vw, rollback := rm.Migrate(r, "getUser")
+				require.NoError(t, err)
+				defer rollback(w)
+
+				legacy = r.Header.Get("X-Legacy-Client")
+				w.Header().Set("X-Legacy-Client", legacy)
+				vw.Write(tc.body)
+			})
+
+			req := httptest.NewRequest(tc.method, "/users/1", nil)
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, "true", legacy)
+			require.Equal(t, "true", rr.Header().Get("Deprecation"))
+			require.Equal(t, string(tc.body), rr.Body.String())
+		})
+	}
+
+	require.Empty(t, rm.Lint())
+}
+
+func Test_RegisterRange(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-05-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{},
+		"2023-04-01": Migrations{},
+		"2023-05-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterRange("2023-03-01", "2023-04-01", &getUserResponseCombineNamesMigration{})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"getUserResponseCombineNamesMigration"},
+		"2023-04-01": {"getUserResponseCombineNamesMigration"},
+	}, rm.MigrationsForHandler("getUser"))
+
+	err = rm.RegisterRange("2023-03-15", "2023-04-01", &getUserResponseCombineNamesMigration{})
+	require.ErrorIs(t, err, ErrInvalidVersion)
+
+	err = rm.RegisterRange("2023-04-01", "2023-03-01", &getUserResponseCombineNamesMigration{})
+	require.ErrorIs(t, err, ErrInvalidVersion)
+}
+
+func Test_CanaryVersion(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		CanaryVersion:  "2023-03-01",
+		CanaryWeight:   0.25,
+		CanaryRand:     rand.New(rand.NewSource(1)),
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	var canaries int
+	for i := 0; i < 1000; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+
+		v, err := rm.getUserVersion(req)
+		require.NoError(t, err)
+
+		// the decision is stable for the request.
+		vv, err := rm.getUserVersion(req)
+		require.NoError(t, err)
+		require.Equal(t, v.String(), vv.String())
+
+		if v.String() == "2023-03-01" {
+			canaries++
+		}
+	}
+
+	require.InDelta(t, 250, canaries, 50)
+
+	// requests with a version are never routed to the canary.
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Test-Version", "2023-02-01")
+
+	v, err := rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, "2023-02-01", v.String())
+
+	_, err = NewRequestMigration(&RequestMigrationOptions{
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		CanaryWeight:   1.5,
+	})
+	require.Error(t, err)
+}
+
+func Test_SetCurrentVersion(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-02-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&createUserRequestSplitNameMigration{},
+			&createUserResponseCombineNamesMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	body := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	migrate := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		req.Header.Set("X-Test-Version", "2023-02-01")
+
+		err, _, _ := rm.Migrate(req, "createUser")
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	require.JSONEq(t, body, migrate())
+
+	require.ErrorIs(t, rm.SetCurrentVersion("2023-04-01"), ErrInvalidVersion)
+	require.NoError(t, rm.SetCurrentVersion("2023-03-01"))
+
+	require.JSONEq(t, `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`, migrate())
+}
+
+func Test_MigrateFrame(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	err := rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	oldFrame := []byte(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`)
+	newFrame := []byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+
+	data, err := rm.MigrateFrame("2023-02-01", "createUser", DirectionRequest, oldFrame)
+	require.NoError(t, err)
+	require.JSONEq(t, string(newFrame), string(data))
+
+	data, err = rm.MigrateFrame("2023-02-01", "createUser", DirectionResponse, newFrame)
+	require.NoError(t, err)
+	require.JSONEq(t, string(oldFrame), string(data))
+
+	_, err = rm.MigrateFrame("2023-02-01", "createUser", Direction("sideways"), newFrame)
+	require.Error(t, err)
+}
+
+func Test_MigrateHTTPResponse(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	err := rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	newResponse := func(body string) *http.Response {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}
+	}
+
+	// responses without a version are on the current version.
+	resp := newResponse(newBody)
+	err = rm.MigrateHTTPResponse(resp, "getUser", "2023-02-01")
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, oldBody, string(data))
+	require.Equal(t, int64(len(data)), resp.ContentLength)
+	require.Equal(t, strconv.Itoa(len(data)), resp.Header.Get("Content-Length"))
+	require.Equal(t, "2023-02-01", resp.Header.Get("X-Test-Version"))
+
+	// older responses are migrated forward.
+	resp = newResponse(oldBody)
+	resp.Header.Set("X-Test-Version", "2023-02-01")
+	err = rm.MigrateHTTPResponse(resp, "createUser", "2023-03-01")
+	require.NoError(t, err)
+
+	data, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, newBody, string(data))
+
+	// the body can still be read after an error.
+	resp = newResponse(newBody)
+	err = rm.MigrateHTTPResponse(resp, "getUser", "2023-02-15")
+	require.ErrorIs(t, err, ErrInvalidVersion)
+
+	data, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, newBody, string(data))
+}
+
+func Test_DefaultVersion(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		DefaultVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	body := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+
+	err, _, _ = rm.Migrate(req, "createUser")
+	require.NoError(t, err)
+
+	// requests without a version are on the default version, so aren't
+	// migrated.
+	data, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, body, string(data))
+}
+
+func Test_RejectEmptyVersionHeader(t *testing.T) {
+	tests := map[string]struct {
+		reject   bool
+		header   []string
+		expected string
+		err      error
+	}{
+		"empty uses default": {
+			header:   []string{""},
+			expected: "2023-02-01",
+		},
+		"whitespace uses default": {
+			header:   []string{"  "},
+			expected: "2023-02-01",
+		},
+		"empty rejected": {
+			reject: true,
+			header: []string{""},
+			err:    ErrInvalidVersion,
+		},
+		"whitespace rejected": {
+			reject: true,
+			header: []string{"  "},
+			err:    ErrInvalidVersion,
+		},
+		"missing uses default": {
+			reject:   true,
+			expected: "2023-02-01",
+		},
+		"set": {
+			reject:   true,
+			header:   []string{"2023-03-01"},
+			expected: "2023-03-01",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:            "X-Test-Version",
+				CurrentVersion:           "2023-03-01",
+				DefaultVersion:           "2023-02-01",
+				VersionFormat:            DateFormat,
+				RejectEmptyVersionHeader: tc.reject,
+			})
+			require.NoError(t, err)
+			registerBasicMigrations(t, rm)
+
+			err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			for _, v := range tc.header {
+				req.Header.Add("X-Test-Version", v)
+			}
+
+			v, err := rm.getUserVersion(req)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, v.String())
+		})
+	}
+}
+
+func Test_DefaultVersion_Omitted(t *testing.T) {
+	tests := map[string]struct {
+		defaultVersion string
+		expected       string
+		err            error
+	}{
+		"unset_migrates_from_oldest": {
+			expected: `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`,
+		},
+		"registered": {
+			defaultVersion: "2023-02-01",
+			expected:       `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`,
+		},
+		"current": {
+			defaultVersion: "2023-03-01",
+			expected:       `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`,
+		},
+		"unregistered": {
+			defaultVersion: "2023-02-15",
+			err:            ErrInvalidVersion,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:  "X-Test-Version",
+				CurrentVersion: "2023-03-01",
+				DefaultVersion: tc.defaultVersion,
+				VersionFormat:  DateFormat,
+			})
+			require.NoError(t, err)
+			registerBasicMigrations(t, rm)
+
+			err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+			require.NoError(t, err)
+
+			if tc.err != nil {
+				require.ErrorIs(t, rm.Validate(), tc.err)
+			} else {
+				require.NoError(t, rm.Validate())
+			}
+
+			body := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+
+			err, _, _ = rm.Migrate(req, "createUser")
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.expected, string(data))
+		})
+	}
+}
+
+func Test_MetricsDirection(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	reg := prometheus.NewRegistry()
+	rm.RegisterMetrics(reg)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	req.Header.Set("Content-Type", "application/json")
+
+	err := rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	createUser(t, rm).ServeHTTP(httptest.NewRecorder(), req)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+
+	observed := make(map[string]string)
+	for _, metric := range families[0].GetMetric() {
+		labels := make(map[string]string)
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+
+		require.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+		observed[labels["direction"]] = labels["from"] + "->" + labels["to"]
+	}
+
+	require.Equal(t, map[string]string{
+		"request":  "2023-02-01->2023-03-01",
+		"response": "2023-03-01->2023-02-01",
+	}, observed)
+}
+
+// fakeClock advances by step every time it's read.
+type fakeClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func Test_Clock(t *testing.T) {
+	clock := &fakeClock{
+		now:  time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+		step: 250 * time.Millisecond,
+	}
+	sink := &auditLog{}
+
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		AuditSink:      sink,
+		Clock:          clock,
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	reg := prometheus.NewRegistry()
+	rm.RegisterMetrics(reg)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	req.Header.Set("Content-Type", "application/json")
+
+	createUser(t, rm).ServeHTTP(httptest.NewRecorder(), req)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+
+	require.Len(t, families[0].GetMetric(), 2)
+	for _, metric := range families[0].GetMetric() {
+		// each migration reads the clock once in between its start and end.
+		require.InDelta(t, 0.5, metric.GetHistogram().GetSampleSum(), 1e-9)
+	}
+
+	require.Len(t, sink.entries, 2)
+	require.Equal(t, time.Date(2023, 3, 1, 0, 0, 0, 500_000_000, time.UTC), sink.entries[0].Timestamp)
+}
+
+func Test_NegotiateVersion(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "Accept-Version",
+		CurrentVersion: "2023-05-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{},
+		"2023-05-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		header   string
+		expected string
+		err      error
+	}{
+		"single_version": {
+			header:   "2023-03-01",
+			expected: "2023-03-01",
+		},
+		"newest_supported": {
+			header:   "2023-08-01, 2023-03-01, 2023-05-01",
+			expected: "2023-05-01",
+		},
+		"skips_unsupported": {
+			header:   "2023-08-01,2023-02-01",
+			expected: "2023-02-01",
+		},
+		"none_supported": {
+			header: "2023-08-01, 2023-04-01",
+			err:    ErrUnknownVersion,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Accept-Version", tc.header)
+
+			v, err := rm.getUserVersion(req)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, v.String())
+		})
+	}
+}
+
+func Test_SkipHeader(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	tests := map[string]struct {
+		allow    bool
+		skip     string
+		expected string
+		logged   bool
+	}{
+		"skipped": {
+			allow:    true,
+			skip:     "true",
+			expected: newBody,
+			logged:   true,
+		},
+		"not_allowed": {
+			skip:     "true",
+			expected: `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`,
+		},
+		"not_requested": {
+			allow:    true,
+			expected: `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			logs.Reset()
+
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:   "X-Test-Version",
+				CurrentVersion:  "2023-03-01",
+				VersionFormat:   DateFormat,
+				AllowSkipHeader: tc.allow,
+			})
+			require.NoError(t, err)
+			registerBasicMigrations(t, rm)
+
+			err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tc.expected))
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			req.Header.Set("Content-Type", "application/json")
+			if tc.skip != "" {
+				req.Header.Set("X-Skip-Migrations", tc.skip)
+			}
+
+			rr := httptest.NewRecorder()
+			createUser(t, rm).ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.JSONEq(t, tc.expected, rr.Body.String())
+			require.Equal(t, tc.logged, strings.Contains(logs.String(), "X-Skip-Migrations"))
+		})
+	}
+}
+
+func Test_NewVersion(t *testing.T) {
+	tests := map[string]struct {
+		format VersionFormat
+		value  string
+		err    error
+	}{
+		"date":            {format: DateFormat, value: "2023-03-01"},
+		"semver":          {format: SemverFormat, value: "v1.2.0"},
+		"date_mismatch":   {format: DateFormat, value: "v1.2.0", err: ErrInvalidVersionFormat},
+		"semver_mismatch": {format: SemverFormat, value: "latest", err: ErrInvalidVersionFormat},
+		"unknown_format":  {format: VersionFormat("calver"), value: "2023.03", err: ErrInvalidVersionFormat},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v, err := NewVersion(tc.format, tc.value)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.value, v.String())
+		})
+	}
+
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{"v1.2.0": Migrations{}})
+	require.ErrorIs(t, err, ErrInvalidVersionFormat)
+}
+
+func Test_EnvelopePath(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		EnvelopePath:   "data.user",
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		body     string
+		expected string
+	}{
+		"enveloped": {
+			body:     `{"status":true,"message":"user fetched","data":{"user":{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"},"role":"admin"}}`,
+			expected: `{"status":true,"message":"user fetched","data":{"user":{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"},"role":"admin"}}`,
+		},
+		"no_message": {
+			body:     `{"status":false,"message":"user not found"}`,
+			expected: `{"status":false,"message":"user not found"}`,
+		},
+		"null_message": {
+			body:     `{"status":true,"message":"no user","data":{"user":null}}`,
+			expected: `{"status":true,"message":"no user","data":{"user":null}}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err, vw, rollback := rm.Migrate(r, "getUser")
+				require.NoError(t, err)
+				defer rollback(w)
+
+				vw.Header(http.Header{"Content-Type": {"application/json"}})
+				vw.Write([]byte(tc.body))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.JSONEq(t, tc.expected, rr.Body.String())
+		})
+	}
+
+	_, err = NewRequestMigration(&RequestMigrationOptions{
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		EnvelopePath:   "data",
+		EnvelopeCodec:  ConnectEnvelopeCodec{},
+	})
+	require.Error(t, err)
+}
+
+type getUserResponseScopedMigration struct{}
+
+func (c *getUserResponseScopedMigration) Scope() []string {
+	return []string{"data"}
+}
+
+func (c *getUserResponseScopedMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	var res struct {
+		Data user `json:"data"`
+	}
+	err := json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// status is out of scope, so it's ignored.
+	return json.RawMessage(fmt.Sprintf(`{"status":false,"data":{"email":%q,"full_name":%q}}`,
+		res.Data.Email, res.Data.FirstName+" "+res.Data.LastName)), h, nil
+}
+
+func Test_ScopedMigration(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{&getUserResponseScopedMigration{}},
+	})
+	require.NoError(t, err)
+
+	data, err := rm.Convert("2023-03-01", "2023-02-01", "getUser",
+		[]byte(`{"status":true,"message":"user fetched","data":{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"status":true,"message":"user fetched","data":{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}}`, string(data))
+
+	_, err = rm.Convert("2023-03-01", "2023-02-01", "getUser", []byte(`[]`))
+	require.Error(t, err)
+}
+
+func Test_Migrate_SameVersionAllocs(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	body := []byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+	req.Header.Set("X-Test-Version", "2023-03-01")
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		err, vw, rollback := rm.Migrate(req, "createUser")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vw.Write(body)
+		rollback(w)
+		w.Body.Reset()
+	})
+
+	// only the response and rollback Migrate returns are allocated.
+	require.LessOrEqual(t, allocs, float64(2))
+}
+
+func Test_Migrate_RollbackOnce(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(oldBody))
+	req.Header.Set("X-Test-Version", rm.iv)
+
+	err, vw, rollback := rm.Migrate(req, "createUser")
+	require.NoError(t, err)
+
+	vw.SetHeader(http.StatusCreated)
+	vw.Write([]byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`))
+
+	rr := httptest.NewRecorder()
+	rollback(rr)
+	require.Equal(t, http.StatusCreated, rr.Code)
+	require.JSONEq(t, oldBody, rr.Body.String())
+
+	// later requests don't share state with this one, so calling rollback
+	// again after they've run writes nothing.
+	other := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(oldBody))
+	other.Header.Set("X-Test-Version", rm.iv)
+	createUser(t, rm).ServeHTTP(httptest.NewRecorder(), other)
+
+	rr = httptest.NewRecorder()
+	rollback(rr)
+	require.Zero(t, rr.Body.Len())
+
+	// the migrated body stays readable after rollback.
+	payload, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`, string(payload))
+}
+
+// BenchmarkMigrate_SameVersion measures requests already on the current
+// version, which are passed through without reading or copying anything.
+func BenchmarkMigrate_SameVersion(b *testing.B) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{&createUserRequestSplitNameMigration{}},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	body := []byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`)
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+	req.Header.Set("X-Test-Version", "2023-03-01")
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err, vw, rollback := rm.Migrate(req, "createUser")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		vw.Write(body)
+		rollback(w)
+		w.Body.Reset()
+	}
+}
+
+func Test_Migrate_SameVersionPassThrough(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	payload := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+	body := strings.NewReader(payload)
+	req := httptest.NewRequest(http.MethodPost, "/users", body)
+	req.Header.Set("X-Test-Version", "2023-03-01")
+
+	err, _, _ := rm.Migrate(req, "createUser")
+	require.NoError(t, err)
+
+	// the body wasn't read, and the request isn't marked migrated.
+	require.Equal(t, len(payload), body.Len())
+	require.False(t, isMigrated(req))
+}
+
+func Test_SplitAndJoinFields(t *testing.T) {
+	split := SplitField("address", []string{"street", "city", "zip"}, func(s string) []string {
+		return strings.Split(s, ", ")
+	})
+	join := JoinFields([]string{"street", "city", "zip"}, "address", func(parts []string) string {
+		return strings.Join(parts, ", ")
+	})
+
+	tests := map[string]struct {
+		old string
+		new string
+	}{
+		"values": {
+			old: `{"id":1,"address":"1 Main St, Lagos, 100001"}`,
+			new: `{"id":1,"street":"1 Main St","city":"Lagos","zip":"100001"}`,
+		},
+		"null": {
+			old: `{"id":1,"address":null}`,
+			new: `{"id":1,"street":null,"city":null,"zip":null}`,
+		},
+		"missing": {
+			old: `{"id":1}`,
+			new: `{"id":1}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := ApplyFieldTransforms([]byte(tc.old), split)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.new, string(data))
+
+			data, err = ApplyFieldTransforms(data, join)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.old, string(data))
+		})
+	}
+
+	_, err := ApplyFieldTransforms([]byte(`{"address":"1 Main St"}`), split)
+	require.Error(t, err)
+
+	_, err = ApplyFieldTransforms([]byte(`{"address":42}`), split)
+	require.Error(t, err)
+}
+
+func Test_ApplyFieldTransforms_Precision(t *testing.T) {
+	data, err := ApplyFieldTransforms([]byte(`{"id":9007199254740993,"amount":0.1,"email":"a@b.c"}`), RemovePointer("/email"))
+	require.NoError(t, err)
+	require.Equal(t, `{"amount":0.1,"id":9007199254740993}`, string(data))
+
+	data, err = ApplyFieldTransforms([]byte(`{"id":9007199254740993}`), CoerceType("id", NumberField, StringField, CoerceFail))
+	require.NoError(t, err)
+	require.Equal(t, `{"id":"9007199254740993"}`, string(data))
+
+	_, err = ApplyFieldTransforms([]byte(`{"id":1}]`))
+	require.Error(t, err)
+}
+
+func Test_FieldHelpers(t *testing.T) {
+	tests := map[string]struct {
+		forward  FieldTransform
+		backward FieldTransform
+		old      string
+		new      string
+	}{
+		"rename": {
+			forward:  RenameField("username", "email"),
+			backward: RenameField("email", "username"),
+			old:      `{"id":1,"username":"a@b.c"}`,
+			new:      `{"id":1,"email":"a@b.c"}`,
+		},
+		"rename missing": {
+			forward:  RenameField("username", "email"),
+			backward: RenameField("email", "username"),
+			old:      `{"id":1}`,
+			new:      `{"id":1}`,
+		},
+		"add and drop": {
+			forward:  AddField("status", "active"),
+			backward: DropField("status"),
+			old:      `{"id":1}`,
+			new:      `{"id":1,"status":"active"}`,
+		},
+		"move nested": {
+			forward:  MoveField("/profile/email", "/contact/primary/email"),
+			backward: MoveField("/contact/primary/email", "/profile/email"),
+			old:      `{"id":1,"profile":{"email":"a@b.c"}}`,
+			new:      `{"id":1,"contact":{"primary":{"email":"a@b.c"}}}`,
+		},
+		"move keeps siblings": {
+			forward:  MoveField("/profile/email", "/email"),
+			backward: MoveField("/email", "/profile/email"),
+			old:      `{"profile":{"email":"a@b.c","bio":"x"}}`,
+			new:      `{"email":"a@b.c","profile":{"bio":"x"}}`,
+		},
+		"move missing": {
+			forward:  MoveField("/profile/email", "/email"),
+			backward: MoveField("/email", "/profile/email"),
+			old:      `{"id":1}`,
+			new:      `{"id":1}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := ApplyFieldTransforms([]byte(tc.old), tc.forward)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.new, string(data))
+
+			data, err = ApplyFieldTransforms(data, tc.backward)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.old, string(data))
+		})
+	}
+
+	_, err := ApplyFieldTransforms([]byte(`{"email":"a@b.c","profile":"x"}`), MoveField("/email", "/profile/email"))
+	require.Error(t, err)
+}
+
+func Test_DefaultField(t *testing.T) {
+	tests := map[string]struct {
+		old string
+		new string
+	}{
+		"missing": {
+			old: `{"id":1}`,
+			new: `{"id":1,"currency":"NGN"}`,
+		},
+		"present": {
+			old: `{"id":1,"currency":"USD"}`,
+			new: `{"id":1,"currency":"USD"}`,
+		},
+		"null": {
+			old: `{"id":1,"currency":null}`,
+			new: `{"id":1,"currency":null}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := ApplyFieldTransforms([]byte(tc.old), DefaultField("currency", "NGN"))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.new, string(data))
+		})
+	}
+}
+
+func Test_CoerceType(t *testing.T) {
+	tests := map[string]struct {
+		field    string
+		from, to FieldType
+		old      string
+		new      string
+	}{
+		"number to string": {
+			field: "id",
+			from:  NumberField,
+			to:    StringField,
+			old:   `{"id":42}`,
+			new:   `{"id":"42"}`,
+		},
+		"bool to string": {
+			field: "active",
+			from:  BoolField,
+			to:    StringField,
+			old:   `{"active":true}`,
+			new:   `{"active":"true"}`,
+		},
+		"bool to number": {
+			field: "active",
+			from:  BoolField,
+			to:    NumberField,
+			old:   `{"active":false}`,
+			new:   `{"active":0}`,
+		},
+		"null": {
+			field: "id",
+			from:  NumberField,
+			to:    StringField,
+			old:   `{"id":null}`,
+			new:   `{"id":null}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := ApplyFieldTransforms([]byte(tc.old), CoerceType(tc.field, tc.from, tc.to, CoerceFail))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.new, string(data))
+
+			data, err = ApplyFieldTransforms(data, CoerceType(tc.field, tc.to, tc.from, CoerceFail))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.old, string(data))
+		})
+	}
+
+	toNumber := func(policy CoercePolicy) FieldTransform {
+		return CoerceType("id", StringField, NumberField, policy)
+	}
+
+	_, err := ApplyFieldTransforms([]byte(`{"id":"abc"}`), toNumber(CoerceFail))
+	require.Error(t, err)
+
+	data, err := ApplyFieldTransforms([]byte(`{"id":"abc"}`), toNumber(CoerceKeep))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":"abc"}`, string(data))
+
+	data, err = ApplyFieldTransforms([]byte(`{"id":"abc"}`), toNumber(CoerceNull))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":null}`, string(data))
+
+	_, err = ApplyFieldTransforms([]byte(`{"id":"Inf"}`), toNumber(CoerceFail))
+	require.Error(t, err)
+
+	_, err = ApplyFieldTransforms([]byte(`{"id":2}`), CoerceType("id", NumberField, BoolField, CoerceFail))
+	require.Error(t, err)
+}
+
+func Test_TimestampFormat(t *testing.T) {
+	tests := map[string]struct {
+		from, to TimeFormat
+		old      string
+		new      string
+	}{
+		"epoch seconds to rfc3339": {
+			from: EpochSeconds,
+			to:   RFC3339,
+			old:  `{"created_at":1677672000}`,
+			new:  `{"created_at":"2023-03-01T12:00:00Z"}`,
+		},
+		"epoch millis to rfc3339": {
+			from: EpochMillis,
+			to:   RFC3339,
+			old:  `{"created_at":1677672000123}`,
+			new:  `{"created_at":"2023-03-01T12:00:00.123Z"}`,
+		},
+		"epoch seconds to epoch millis": {
+			from: EpochSeconds,
+			to:   EpochMillis,
+			old:  `{"created_at":1677672000}`,
+			new:  `{"created_at":1677672000000}`,
+		},
+		"before the epoch": {
+			from: EpochSeconds,
+			to:   RFC3339,
+			old:  `{"created_at":-86400}`,
+			new:  `{"created_at":"1969-12-31T00:00:00Z"}`,
+		},
+		"null": {
+			from: EpochSeconds,
+			to:   RFC3339,
+			old:  `{"created_at":null}`,
+			new:  `{"created_at":null}`,
+		},
+		"absent": {
+			from: EpochSeconds,
+			to:   RFC3339,
+			old:  `{"id":1}`,
+			new:  `{"id":1}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := ApplyFieldTransforms([]byte(tc.old), TimestampFormat("created_at", tc.from, tc.to))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.new, string(data))
+
+			data, err = ApplyFieldTransforms(data, TimestampFormat("created_at", tc.to, tc.from))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.old, string(data))
+		})
+	}
+
+	// other zones are converted to UTC.
+	data, err := ApplyFieldTransforms([]byte(`{"created_at":"2023-03-01T13:00:00+01:00"}`), TimestampFormat("created_at", RFC3339, EpochSeconds))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"created_at":1677672000}`, string(data))
+
+	// precision epoch seconds can't hold is truncated.
+	data, err = ApplyFieldTransforms([]byte(`{"created_at":"2023-03-01T12:00:00.999Z"}`), TimestampFormat("created_at", RFC3339, EpochSeconds))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"created_at":1677672000}`, string(data))
+
+	var m map[string]any
+	err = json.Unmarshal([]byte(`{"created_at":1677672000.5}`), &m)
+	require.NoError(t, err)
+	err = TimestampFormat("created_at", EpochSeconds, RFC3339)(m)
+	require.NoError(t, err)
+	require.Equal(t, "2023-03-01T12:00:00.5Z", m["created_at"])
+
+	_, err = ApplyFieldTransforms([]byte(`{"created_at":"yesterday"}`), TimestampFormat("created_at", RFC3339, EpochSeconds))
+	require.Error(t, err)
+
+	_, err = ApplyFieldTransforms([]byte(`{"created_at":"1677672000"}`), TimestampFormat("created_at", EpochSeconds, RFC3339))
+	require.Error(t, err)
+}
+
+type getUserResponseLabelledMigration struct {
+	getUserResponseCombineNamesMigration
+}
+
+func (c *getUserResponseLabelledMigration) MetricLabels() map[string]string {
+	return map[string]string{"change": "combine_names", "ignored": "value"}
+}
+
+func Test_MetricLabels(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		MetricLabels:   []string{"change"},
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&getUserResponseLabelledMigration{},
+			&createUserRequestSplitNameMigration{},
+			&createUserResponseCombineNamesMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	reg := prometheus.NewRegistry()
+	rm.RegisterMetrics(reg)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	getUser(t, rm).ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	createUser(t, rm).ServeHTTP(httptest.NewRecorder(), req)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+
+	observed := make(map[string]string)
+	for _, metric := range families[0].GetMetric() {
+		labels := make(map[string]string)
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+
+		require.NotContains(t, labels, "ignored")
+		observed[labels["direction"]+"/"+labels["change"]] = labels["from"]
+	}
+
+	require.Equal(t, map[string]string{
+		"request/":               "2023-02-01",
+		"response/":              "2023-03-01",
+		"response/combine_names": "2023-03-01",
+	}, observed)
+
+	_, err = NewRequestMigration(&RequestMigrationOptions{
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+		MetricLabels:   []string{"from"},
+	})
+	require.Error(t, err)
+}
+
+type getUserResponseNilBodyMigration struct{}
+
+func (c *getUserResponseNilBodyMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return nil, h, nil
+}
+
+type createUserRequestNilBodyMigration struct{}
+
+func (c *createUserRequestNilBodyMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return nil, h, nil
+}
+
+func Test_MigrationReturnedNilBody(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&getUserResponseNilBodyMigration{},
+			&createUserRequestNilBodyMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"engineering@getconvoy.io"}`))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+
+	err, _, _ = rm.Migrate(req, "createUser")
+	require.ErrorIs(t, err, ErrMigrationReturnedNilBody)
+
+	req = httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "getUser")
+		require.NoError(t, err)
+		defer rollback(w)
+
+		vw.Write([]byte(`{"email":"engineering@getconvoy.io"}`))
+	})
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Empty(t, rr.Body.String())
+
+	_, err = rm.Convert("2023-03-01", "2023-02-01", "getUser", []byte(`{}`))
+	require.ErrorIs(t, err, ErrMigrationReturnedNilBody)
+}
+
+// listUsersResponseCursorPaginationMigration rewrites the cursor based
+// pagination introduced in 2023-03-01 to the page numbers older clients
+// expect, and migrates each item in the list.
+type listUsersResponseCursorPaginationMigration struct{}
+
+func (c *listUsersResponseCursorPaginationMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	var res struct {
+		Data       []json.RawMessage `json:"data"`
+		Pagination struct {
+			NextCursor string `json:"next_cursor"`
+			Limit      int    `json:"limit"`
+		} `json:"pagination"`
+	}
+	err := json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// items are migrated with the same logic as a single user.
+	items := make([]json.RawMessage, len(res.Data))
+	for i, item := range res.Data {
+		items[i], _, err = (&getUserResponseCombineNamesMigration{}).Migrate(item, h)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// cursors encode the offset of the next page, e.g. "offset:40".
+	offset, err := strconv.Atoi(strings.TrimPrefix(res.Pagination.NextCursor, "offset:"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err = json.Marshal(map[string]any{
+		"data": items,
+		"pagination": map[string]int{
+			"page":     offset / res.Pagination.Limit,
+			"per_page": res.Pagination.Limit,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, h, nil
+}
+
+func Test_PaginatedResponse(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{&listUsersResponseCursorPaginationMigration{}},
+	})
+	require.NoError(t, err)
+
+	data, err := rm.Convert("2023-03-01", "2023-02-01", "listUsers", []byte(`{
+		"data": [
+			{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"},
+			{"email":"sales@getconvoy.io","first_name":"Convoy","last_name":"Sales"}
+		],
+		"pagination": {"next_cursor":"offset:40","limit":20}
+	}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"data": [
+			{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"},
+			{"email":"sales@getconvoy.io","full_name":"Convoy Sales"}
+		],
+		"pagination": {"page":2,"per_page":20}
+	}`, string(data))
+}
+
+func Test_ETag(t *testing.T) {
+	serve := func(rm *RequestMigration, ifNoneMatch string) *httptest.ResponseRecorder {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err, vw, rollback := rm.Migrate(r, "getUser")
+			require.NoError(t, err)
+			defer rollback(w)
+
+			vw.Header(http.Header{
+				"Content-Type": {"application/json"},
+				"Etag":         {`"current-version-etag"`},
+			})
+			vw.Write([]byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`))
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set("X-Test-Version", "2023-02-01")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	newRM := func(recompute bool) *RequestMigration {
+		rm, err := NewRequestMigration(&RequestMigrationOptions{
+			VersionHeader:  "X-Test-Version",
+			CurrentVersion: "2023-03-01",
+			VersionFormat:  DateFormat,
+			RecomputeETag:  recompute,
+		})
+		require.NoError(t, err)
+		registerBasicMigrations(t, rm)
+
+		err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+		require.NoError(t, err)
+		return rm
+	}
+
+	t.Run("stripped", func(t *testing.T) {
+		rr := serve(newRM(false), "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Empty(t, rr.Header().Get("ETag"))
+	})
+
+	t.Run("recomputed", func(t *testing.T) {
+		rm := newRM(true)
+
+		rr := serve(rm, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		etag := rr.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+		require.NotEqual(t, `"current-version-etag"`, etag)
+
+		// the ETag is stable for the same migrated body.
+		require.Equal(t, etag, serve(rm, "").Header().Get("ETag"))
+
+		rr = serve(rm, etag)
+		require.Equal(t, http.StatusNotModified, rr.Code)
+		require.Empty(t, rr.Body.String())
+
+		rr = serve(rm, `"current-version-etag"`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`, rr.Body.String())
+	})
+}
+
+// getUserResponseSelectedFieldsMigration only combines the names of users
+// whose client selected full_name.
+type getUserResponseSelectedFieldsMigration struct{}
+
+func (c *getUserResponseSelectedFieldsMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return c.MigrateContext(context.Background(), body, h)
+}
+
+func (c *getUserResponseSelectedFieldsMigration) MigrateContext(
+	ctx context.Context,
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+
+	var m map[string]any
+	err := json.Unmarshal(body, &m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if FieldSelected(ctx, "full_name") {
+		m["full_name"] = fmt.Sprintf("%s %s", m["first_name"], m["last_name"])
+	}
+
+	delete(m, "first_name")
+	delete(m, "last_name")
+
+	body, err = json.Marshal(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, h, nil
+}
+
+func Test_SelectedFields(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{&getUserResponseSelectedFieldsMigration{}},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		fields   []string
+		expected string
+	}{
+		"no_selection": {
+			expected: `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`,
+		},
+		"selected": {
+			fields:   []string{"email", "full_name"},
+			expected: `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`,
+		},
+		"not_selected": {
+			fields:   []string{"email"},
+			expected: `{"email":"engineering@getconvoy.io"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.fields != nil {
+					r = r.WithContext(WithSelectedFields(r.Context(), tc.fields))
+				}
+				require.Equal(t, tc.fields, SelectedFields(r.Context()))
+
+				err, vw, rollback := rm.Migrate(r, "getUser")
+				require.NoError(t, err)
+				defer rollback(w)
+
+				vw.Write([]byte(`{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.JSONEq(t, tc.expected, rr.Body.String())
+		})
+	}
+}
+
+func Test_HeadRequest(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&getUserRequestNilBodyMigration{},
+			&getUserResponseNilBodyMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// both migrations would fail if they ran.
+		err, vw, rollback := rm.Migrate(r, "getUser")
+		require.NoError(t, err)
+		defer rollback(w)
+
+		vw.Header(http.Header{
+			"Content-Type":   {"application/json"},
+			"Content-Length": {"84"},
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodHead, "/users/1", nil)
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "84", rr.Header().Get("Content-Length"))
+	require.Empty(t, rr.Body.String())
+}
+
+type getProfileRequestAuthTokenMigration struct{}
+
+func (g *getProfileRequestAuthTokenMigration) MigrateHeader(h http.Header) error {
+	if token := h.Get("X-Auth-Token"); !isStringEmpty(token) {
+		h.Set("Authorization", "Bearer "+token)
+		h.Del("X-Auth-Token")
+	}
+
+	return nil
+}
+
+type getProfileRequestFailingMigration struct{}
+
+func (g *getProfileRequestFailingMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return nil, nil, errors.New("body migrations shouldn't run without a body")
+}
+
+func Test_VersionRequest_BodylessHeader(t *testing.T) {
+	rm := newRequestMigration(t)
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{
+			&getProfileRequestFailingMigration{},
+		},
+		"2023-03-01": Migrations{
+			HeaderOnly(&getProfileRequestAuthTokenMigration{}),
+		},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		method string
+		body   io.Reader
+	}{
+		"get":     {method: http.MethodGet},
+		"no_body": {method: http.MethodGet, body: http.NoBody},
+		"head":    {method: http.MethodHead},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var authorization, token string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err, _, rollback := rm.Migrate(r, "getProfile")
+				require.NoError(t, err)
+				defer rollback(w)
+
+				authorization = r.Header.Get("Authorization")
+				token = r.Header.Get("X-Auth-Token")
+			})
+
+			req := httptest.NewRequest(tc.method, "/profile", tc.body)
+			req.Header.Set("X-Auth-Token", "secret")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, "Bearer secret", authorization)
+			require.Empty(t, token)
+		})
+	}
+}
+
+type getUserRequestNilBodyMigration struct{}
+
+func (c *getUserRequestNilBodyMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return nil, h, nil
+}
+
+func Test_MaxBodyBytes(t *testing.T) {
+	body := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+
+	tests := map[string]struct {
+		max int64
+		err error
+	}{
+		"no_limit":      {},
+		"within_limit":  {max: int64(len(body))},
+		"exceeds_limit": {max: int64(len(body)) - 1, err: ErrBodyTooLarge},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:  "X-Test-Version",
+				CurrentVersion: "2023-03-01",
+				VersionFormat:  DateFormat,
+				MaxBodyBytes:   tc.max,
+			})
+			require.NoError(t, err)
+			registerBasicMigrations(t, rm)
+
+			err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+			req.Header.Set("X-Test-Version", "2023-02-01")
+
+			err, _, _ = rm.Migrate(req, "createUser")
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func Test_Merge(t *testing.T) {
+	base := newRequestMigration(t)
+	err := base.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{&getUserResponseCombineNamesMigration{}},
+	})
+	require.NoError(t, err)
+
+	rm := newRequestMigration(t)
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&createUserRequestSplitNameMigration{},
+			&createUserResponseCombineNamesMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, rm.Merge(base))
+
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"getUserResponseCombineNamesMigration"},
+	}, rm.MigrationsForHandler("getUser"))
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"createUserRequestSplitNameMigration", "createUserResponseCombineNamesMigration"},
+	}, rm.MigrationsForHandler("createUser"))
+
+	// versions registered in both aren't duplicated.
+	require.Equal(t, []string{"2023-02-01", "2023-03-01"}, rm.versionInfo().Supported)
+
+	// the base set isn't modified.
+	require.Empty(t, base.MigrationsForHandler("createUser"))
+
+	semver, err := NewRequestMigration(&RequestMigrationOptions{
+		CurrentVersion: "v1.0.0",
+		VersionFormat:  SemverFormat,
+	})
+	require.NoError(t, err)
+	require.ErrorIs(t, rm.Merge(semver), ErrInvalidVersionFormat)
+}
+
+func Test_WithForcedVersion(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	err := rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	forced := rm.WithForcedVersion("2023-02-01")
+
+	// no version header is needed, and the one sent is ignored.
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`))
+	req.Header.Set("X-Test-Version", "2023-03-01")
+	rr := httptest.NewRecorder()
+
+	createUser(t, forced).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`, rr.Body.String())
+
+	// rm itself is unaffected.
+	v, err := rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, "2023-03-01", v.String())
+
+	// changes to either instance don't reach the other, even when they're
+	// made concurrently.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		rm.ExcludeHandler("createUser")
+		err := rm.RegisterMigrations(MigrationStore{"2023-01-01": Migrations{}})
+		require.NoError(t, err)
+	}()
+	go func() {
+		defer wg.Done()
+		forced.ExcludeHandler("getUser")
+		err := forced.RegisterMigrations(MigrationStore{"2023-01-15": Migrations{}})
+		require.NoError(t, err)
+	}()
+	wg.Wait()
+
+	require.True(t, rm.isExcluded("createUser"))
+	require.False(t, rm.isExcluded("getUser"))
+	require.False(t, forced.isExcluded("createUser"))
+	require.True(t, forced.isExcluded("getUser"))
+
+	_, ok := rm.Ordinal("2023-01-15")
+	require.False(t, ok)
+	_, ok = forced.Ordinal("2023-01-01")
+	require.False(t, ok)
+}
+
+func Test_PointerTransforms(t *testing.T) {
+	tests := map[string]struct {
+		transform FieldTransform
+		old       string
+		new       string
+	}{
+		"rename nested": {
+			transform: RenamePointer("/users/0/profile/email", "/users/0/email"),
+			old:       `{"users":[{"profile":{"email":"a@b.c","bio":"x"}}]}`,
+			new:       `{"users":[{"email":"a@b.c","profile":{"bio":"x"}}]}`,
+		},
+		"rename to array end": {
+			transform: RenamePointer("/email", "/emails/-"),
+			old:       `{"email":"a@b.c","emails":["d@e.f"]}`,
+			new:       `{"emails":["d@e.f","a@b.c"]}`,
+		},
+		"rename escaped": {
+			transform: RenamePointer("/a~1b", "/m~0n"),
+			old:       `{"a/b":1}`,
+			new:       `{"m~n":1}`,
+		},
+		"rename missing": {
+			transform: RenamePointer("/users/1/email", "/users/1/mail"),
+			old:       `{"users":[{"email":"a@b.c"}]}`,
+			new:       `{"users":[{"email":"a@b.c"}]}`,
+		},
+		"rename onto object": {
+			transform: RenamePointer("/geo", "/address/geo"),
+			old:       `{"geo":{"lat":1},"address":{"city":"Lagos","geo":{"lng":2}}}`,
+			new:       `{"address":{"city":"Lagos","geo":{"lat":1,"lng":2}}}`,
+		},
+		"remove array element": {
+			transform: RemovePointer("/users/0"),
+			old:       `{"users":[{"id":1},{"id":2}]}`,
+			new:       `{"users":[{"id":2}]}`,
+		},
+		"remove nested": {
+			transform: RemovePointer("/users/1/profile"),
+			old:       `{"users":[{"id":1},{"id":2,"profile":{}}]}`,
+			new:       `{"users":[{"id":1},{"id":2}]}`,
+		},
+		"remove leading zero index": {
+			transform: RemovePointer("/users/01"),
+			old:       `{"users":[{"id":1},{"id":2}]}`,
+			new:       `{"users":[{"id":1},{"id":2}]}`,
+		},
+		"replace": {
+			transform: ReplacePointer("/users/0/status", "active"),
+			old:       `{"users":[{"status":1}]}`,
+			new:       `{"users":[{"status":"active"}]}`,
+		},
+		"replace missing": {
+			transform: ReplacePointer("/users/0/status", "active"),
+			old:       `{"users":[{}]}`,
+			new:       `{"users":[{}]}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := ApplyFieldTransforms([]byte(tc.old), tc.transform)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.new, string(data))
+		})
+	}
+
+	_, err := ApplyFieldTransforms([]byte(`{"email":"a@b.c"}`), RemovePointer("email"))
+	require.Error(t, err)
+
+	_, err = ApplyFieldTransforms([]byte(`{"email":"a@b.c"}`), RenamePointer("/email", "/profile/email"))
+	require.Error(t, err)
+}
+
+func Test_DeepMerge(t *testing.T) {
+	dst := map[string]any{
+		"name": "Ada",
+		"address": map[string]any{
+			"city": "Lagos",
+			"geo":  map[string]any{"lat": 6.5, "lng": 3.4},
+		},
+		"tags": []any{"a"},
+	}
+
+	DeepMerge(dst, map[string]any{
+		"address": map[string]any{
+			"zip": "100001",
+			"geo": map[string]any{"lat": 6.6, "alt": nil},
+		},
+		"tags": []any{"b"},
+	})
+
+	require.Equal(t, map[string]any{
+		"name": "Ada",
+		"address": map[string]any{
+			"city": "Lagos",
+			"zip":  "100001",
+			"geo":  map[string]any{"lat": 6.6, "lng": 3.4, "alt": nil},
+		},
+		"tags": []any{"b"},
+	}, dst)
+
+	// a scalar in src replaces an object in dst, and vice versa.
+	dst = map[string]any{"address": map[string]any{"city": "Lagos"}, "geo": "6.5,3.4"}
+	DeepMerge(dst, map[string]any{"address": "Lagos", "geo": map[string]any{"lat": 6.5}})
+	require.Equal(t, map[string]any{"address": "Lagos", "geo": map[string]any{"lat": 6.5}}, dst)
+}
+
+func Test_OnMigrationError(t *testing.T) {
+	tests := map[string]struct {
+		policy  MigrationErrorPolicy
+		version string
+		err     error
+		code    int
+		body    string
+	}{
+		"fail closed": {
+			policy:  FailClosed,
+			version: "2023-02-01",
+			err:     ErrMigrationReturnedNilBody,
+			code:    http.StatusInternalServerError,
+		},
+		"fail closed unknown version": {
+			policy:  FailClosed,
+			version: "2023-01-15",
+			err:     ErrUnknownVersion,
+			code:    http.StatusInternalServerError,
+		},
+		"fail open": {
+			policy:  FailOpen,
+			version: "2023-02-01",
+			code:    http.StatusOK,
+			body:    `{"email":"engineering@getconvoy.io"}`,
+		},
+		"fail open unknown version": {
+			policy:  FailOpen,
+			version: "2023-01-15",
+			code:    http.StatusOK,
+			body:    `{"email":"engineering@getconvoy.io"}`,
+		},
+		"passthrough": {
+			policy:  Passthrough,
+			version: "2023-02-01",
+			code:    http.StatusOK,
+			body:    `{"email":"engineering@getconvoy.io"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:    "X-Test-Version",
+				CurrentVersion:   "2023-03-01",
+				VersionFormat:    DateFormat,
+				OnMigrationError: tc.policy,
+			})
+			require.NoError(t, err)
+
+			err = rm.RegisterMigrations(MigrationStore{
+				"2023-02-01": Migrations{},
+				"2023-03-01": Migrations{
+					&getUserResponseNilBodyMigration{},
+					&createUserRequestNilBodyMigration{},
+				},
+			})
+			require.NoError(t, err)
+
+			payload := `{"email":"engineering@getconvoy.io"}`
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(payload))
+			req.Header.Set("X-Test-Version", tc.version)
+
+			err, _, _ = rm.Migrate(req, "createUser")
+			require.ErrorIs(t, err, tc.err)
+
+			if tc.err == nil {
+				// the request is served as it was sent.
+				body, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, payload, string(body))
+			}
+
+			req = httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("X-Test-Version", tc.version)
+			rr := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err, vw, rollback := rm.Migrate(r, "getUser")
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				defer rollback(w)
+
+				vw.Write([]byte(payload))
+			})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			require.Equal(t, tc.body, rr.Body.String())
+		})
+	}
+}
+
+func Test_MixedVersionFormats(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:     "X-Test-Version",
+		CurrentVersion:    "v1.1.0",
+		VersionFormat:     DateFormat,
+		VersionFormatFunc: DetectVersionFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"v1.0.0": Migrations{
+			&createUserRequestSplitNameMigration{},
+			&createUserResponseCombineNamesMigration{},
+		},
+		"2023-03-01": Migrations{},
+		"v1.1.0":     Migrations{},
+	})
+	require.NoError(t, err)
+
+	var versions []string
+	for _, v := range rm.versions {
+		versions = append(versions, v.String())
+	}
+	require.Equal(t, []string{"0001-01-01", "2023-02-01", "2023-03-01", "v1.0.0", "v1.1.0"}, versions)
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	// date clients are migrated across the scheme change.
+	data, err := rm.Convert("2023-02-01", "v1.1.0", "createUser", []byte(oldBody))
+	require.NoError(t, err)
+	require.JSONEq(t, newBody, string(data))
+
+	data, err = rm.Convert("v1.1.0", "2023-03-01", "createUser", []byte(newBody))
+	require.NoError(t, err)
+	require.JSONEq(t, oldBody, string(data))
+
+	// semver clients past the change aren't.
+	data, err = rm.Convert("v1.0.0", "v1.1.0", "createUser", []byte(newBody))
+	require.NoError(t, err)
+	require.JSONEq(t, newBody, string(data))
+}
+
+func Test_VersionCompare(t *testing.T) {
+	date := func(v string) *Version { return &Version{Format: DateFormat, Value: v} }
+	sem := func(v string) *Version { return &Version{Format: SemverFormat, Value: v} }
+
+	require.Equal(t, -1, date("2023-02-01").Compare(date("2023-03-01")))
+	require.Equal(t, 0, sem("v1.0.0").Compare(sem("1.0.0")))
+	require.Equal(t, 1, sem("v1.1.0").Compare(sem("v1.0.0")))
+	require.Equal(t, -1, date("2030-01-01").Compare(sem("v0.1.0")))
+	require.Equal(t, 1, sem("v0.1.0").Compare(date("2030-01-01")))
+	require.False(t, sem("v1.0.0").Equal(date("2023-02-01")))
+}
+
+func Test_RegisterFunc(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	fields := []string{"first_name", "last_name"}
+	split := SplitField("full_name", fields, func(s string) []string {
+		return strings.SplitN(s, " ", 2)
+	})
+	join := JoinFields(fields, "full_name", func(parts []string) string {
+		return strings.Join(parts, " ")
+	})
+
+	err = rm.RegisterFunc("2023-03-01", "createUser",
+		func(data []byte, h http.Header) ([]byte, http.Header, error) {
+			data, err := ApplyFieldTransforms(data, split)
+			return data, h, err
+		},
+		func(data []byte, h http.Header) ([]byte, http.Header, error) {
+			data, err := ApplyFieldTransforms(data, join)
+			return data, h, err
+		})
+	require.NoError(t, err)
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(oldBody))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	rr := httptest.NewRecorder()
+
+	createUser(t, rm).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, oldBody, rr.Body.String())
+
+	data, err := rm.Convert("2023-02-01", "2023-03-01", "createUser", []byte(oldBody))
+	require.NoError(t, err)
+	require.JSONEq(t, newBody, string(data))
+
+	// the functions only apply to their handler.
+	data, err = rm.Convert("2023-02-01", "2023-03-01", "createUsers", []byte(oldBody))
+	require.NoError(t, err)
+	require.JSONEq(t, oldBody, string(data))
+
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"function migration for createUser"},
+	}, rm.MigrationsForHandler("createUser"))
+
+	// each function migration is named after its handler and version, so
+	// it can be disabled on its own.
+	err = rm.RegisterFunc("2023-03-01", "updateUser",
+		func(data []byte, h http.Header) ([]byte, http.Header, error) {
+			return []byte(`{"updated":true}`), h, nil
+		}, nil)
+	require.NoError(t, err)
+
+	ctx := rm.WithDisabledMigrations(context.Background(), "createUserFunc@2023-03-01")
+
+	req = httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(oldBody)).WithContext(ctx)
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	err, _, rollback := rm.Migrate(req, "createUser")
+	require.NoError(t, err)
+	payload, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, oldBody, string(payload))
+	rollback(httptest.NewRecorder())
+
+	req = httptest.NewRequest(http.MethodPut, "/users/1", strings.NewReader(oldBody)).WithContext(ctx)
+	req.Header.Set("X-Test-Version", "2023-02-01")
+	err, _, rollback = rm.Migrate(req, "updateUser")
+	require.NoError(t, err)
+	payload, err = io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"updated":true}`, string(payload))
+	rollback(httptest.NewRecorder())
+
+	// only one migration per version runs for a handler, so a function
+	// can't be added alongside another one.
+	err = rm.RegisterFunc("2023-03-01", "createUser", nil, nil)
+	require.ErrorIs(t, err, ErrMigrationConflict)
+
+	err = rm.RegisterMigrations(MigrationStore{"2023-04-01": Migrations{&getUserResponseCombineNamesMigration{}}})
+	require.NoError(t, err)
+	err = rm.RegisterFunc("2023-04-01", "getUser", nil, nil)
+	require.ErrorIs(t, err, ErrMigrationConflict)
+
+	// migrations merged in after a function for its handler are reported by
+	// Lint, since the function shadows them.
+	other := newRequestMigration(t)
+	err = other.RegisterMigrations(MigrationStore{"2023-03-01": Migrations{&createUserRequestSplitNameMigration{}}})
+	require.NoError(t, err)
+	err = rm.Merge(other)
+	require.NoError(t, err)
+
+	var warnings []string
+	for _, w := range rm.Lint() {
+		warnings = append(warnings, w.String())
+	}
+	require.Contains(t, warnings, "2023-03-01: createUserRequestSplitNameMigration is shadowed by createUserFunc@2023-03-01, registered before it for the same handler")
+}
+
+func Test_LoadMigrations(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.LoadMigrations(strings.NewReader(`{
+		"2023-02-01": [],
+		"2023-03-01": [
+			{"handler": "createUser", "op": "rename", "from": "username", "to": "email"},
+			{"handler": "createUser", "op": "drop", "field": "nickname"},
+			{"handler": "createUser", "op": "add", "field": "role", "value": "member"},
+			{"handler": "createUser", "op": "move", "from": "/city", "to": "/address/city"},
+			{"handler": "createUser", "op": "coerce", "field": "id", "from": "number", "to": "string"},
+			{"handler": "getUser", "op": "drop", "field": "nickname", "value": ""}
+		]
+	}`))
+	require.NoError(t, err)
+
+	oldBody := `{"id":9007199254740993,"username":"engineering@getconvoy.io","nickname":"convoy","city":"Lagos"}`
+	newBody := `{"id":"9007199254740993","email":"engineering@getconvoy.io","role":"member","address":{"city":"Lagos"}}`
+
+	data, err := rm.Convert("2023-02-01", "2023-03-01", "createUser", []byte(oldBody))
+	require.NoError(t, err)
+	require.JSONEq(t, newBody, string(data))
+
+	data, err = rm.Convert("2023-03-01", "2023-02-01", "createUser", []byte(newBody))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":9007199254740993,"username":"engineering@getconvoy.io","nickname":null,"city":"Lagos"}`, string(data))
+
+	data, err = rm.Convert("2023-03-01", "2023-02-01", "getUser", []byte(`{"email":"engineering@getconvoy.io"}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"email":"engineering@getconvoy.io","nickname":""}`, string(data))
+
+	require.Equal(t, map[string][]string{
+		"2023-03-01": {"function migration for createUser"},
+	}, rm.MigrationsForHandler("createUser"))
+
+	tests := map[string]string{
+		"malformed":       `{"2023-04-01": [`,
+		"unknown key":     `{"2023-04-01": [{"handler": "createUser", "op": "drop", "field": "a", "fields": "b"}]}`,
+		"unknown op":      `{"2023-04-01": [{"handler": "createUser", "op": "split", "field": "a"}]}`,
+		"missing handler": `{"2023-04-01": [{"op": "drop", "field": "a"}]}`,
+		"missing field":   `{"2023-04-01": [{"handler": "createUser", "op": "rename", "from": "a"}]}`,
+		"unknown type":    `{"2023-04-01": [{"handler": "createUser", "op": "coerce", "field": "a", "from": "number", "to": "date"}]}`,
+		"invalid version": `{"2023-04-01": [], "v1": []}`,
+		"conflict":        `{"2023-04-01": [], "2023-03-01": [{"handler": "createUser", "op": "drop", "field": "a"}]}`,
+	}
+
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := rm.LoadMigrations(strings.NewReader(doc))
+			require.Error(t, err)
+
+			// nothing is registered from an invalid document.
+			_, err = rm.Convert("2023-03-01", "2023-04-01", "createUser", []byte(`{}`))
+			require.ErrorIs(t, err, ErrInvalidVersion)
+		})
+	}
+}
+
+type getUserResponseSuccessOnlyMigration struct {
+	getUserResponseCombineNamesMigration
+}
+
+func (c *getUserResponseSuccessOnlyMigration) AppliesToStatus(code int) bool {
+	return code < http.StatusBadRequest
+}
+
+func Test_AppliesToStatus(t *testing.T) {
+	rm := newRequestMigration(t)
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&getUserResponseSuccessOnlyMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		status   int
+		body     string
+		expected string
+	}{
+		"success": {
+			status:   http.StatusOK,
+			body:     `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`,
+			expected: `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`,
+		},
+		"error": {
+			status:   http.StatusNotFound,
+			body:     `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`,
+			expected: `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			rr := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err, vw, rollback := rm.Migrate(r, "getUser")
+				require.NoError(t, err)
+				defer rollback(w)
+
+				vw.SetHeader(tc.status)
+				vw.Write([]byte(tc.body))
+			})
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+			require.JSONEq(t, tc.expected, rr.Body.String())
+		})
+	}
+}
+
+func Test_SnapshotDiff(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	old := rm.Snapshot()
+	require.Equal(t, []string{"2023-03-01"}, old.Versions)
+	require.Equal(t, []string{
+		"getUserResponseCombineNamesMigration",
+		"createUserRequestSplitNameMigration",
+		"createUserResponseCombineNamesMigration",
+	}, old.Migrations["2023-03-01"])
+
+	diff := rm.Diff(old)
+	require.True(t, diff.Empty())
+
+	err := rm.RegisterMigrations(MigrationStore{
+		"2023-03-01": Migrations{
+			&getUserResponseCombineNamesMigration{},
+			&createUserRequestSplitNameMigration{},
+		},
+		"2023-04-01": Migrations{
+			&getUserResponseLabelledMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	diff = rm.Diff(old)
+	require.False(t, diff.Empty())
+	require.Equal(t, RegistryDiff{
+		AddedVersions: []string{"2023-04-01"},
+		AddedMigrations: map[string][]string{
+			"2023-04-01": {"getUserResponseLabelledMigration"},
+		},
+		RemovedMigrations: map[string][]string{
+			"2023-03-01": {"createUserResponseCombineNamesMigration"},
+		},
+	}, diff)
+}
+
+func Test_RequestBodyRestoredOnError(t *testing.T) {
+	payload := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+
+	tests := map[string]struct {
+		maxBodyBytes int64
+		err          error
+	}{
+		"migration error": {
+			err: ErrMigrationReturnedNilBody,
+		},
+		"body too large": {
+			maxBodyBytes: 16,
+			err:          ErrBodyTooLarge,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:  "X-Test-Version",
+				CurrentVersion: "2023-03-01",
+				VersionFormat:  DateFormat,
+				MaxBodyBytes:   tc.maxBodyBytes,
+			})
+			require.NoError(t, err)
+
+			err = rm.RegisterMigrations(MigrationStore{
+				"2023-02-01": Migrations{},
+				"2023-03-01": Migrations{
+					&createUserRequestNilBodyMigration{},
+				},
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(payload))
+			req.Header.Set("X-Test-Version", "2023-02-01")
+
+			err, _, _ = rm.Migrate(req, "createUser")
+			require.ErrorIs(t, err, tc.err)
+
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.Equal(t, payload, string(body))
+		})
+	}
+}
+
+func Test_MigratableContentTypes(t *testing.T) {
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	tests := map[string]struct {
+		allowed     []string
+		contentType string
+		migrated    bool
+	}{
+		"listed": {
+			allowed:     []string{"application/json", "application/vnd.myapi+json"},
+			contentType: "application/vnd.myapi+json; charset=utf-8",
+			migrated:    true,
+		},
+		"unlisted": {
+			allowed:     []string{"application/json"},
+			contentType: "application/vnd.myapi+json",
+		},
+		"suffix": {
+			allowed:     []string{"+json"},
+			contentType: "application/vnd.myapi+json",
+			migrated:    true,
+		},
+		"suffix mismatch": {
+			allowed:     []string{"+json"},
+			contentType: "text/plain",
+		},
+		"missing content type": {
+			allowed:  []string{"application/json"},
+			migrated: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:          "X-Test-Version",
+				CurrentVersion:         "2023-03-01",
+				VersionFormat:          DateFormat,
+				MigratableContentTypes: tc.allowed,
+			})
+			require.NoError(t, err)
+			registerBasicMigrations(t, rm)
+
+			err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(oldBody))
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			req.Header.Set("Content-Type", tc.contentType)
+
+			err, _, _ = rm.Migrate(req, "createUser")
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+
+			expected := oldBody
+			if tc.migrated {
+				expected = newBody
+			}
+			require.JSONEq(t, expected, string(data))
+
+			req = httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("X-Test-Version", "2023-02-01")
+			rr := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err, vw, rollback := rm.Migrate(r, "getUser")
+				require.NoError(t, err)
+				defer rollback(w)
+
+				w.Header().Set("Content-Type", tc.contentType)
+				vw.Write([]byte(newBody))
+			})
+			handler.ServeHTTP(rr, req)
+
+			expected = newBody
+			if tc.migrated {
+				expected = oldBody
+			}
+			require.JSONEq(t, expected, rr.Body.String())
+		})
+	}
+}
+
+var errUnsupportedField = errors.New("unsupported field")
+
+type getUserResponseFailingMigration struct{}
+
+func (c *getUserResponseFailingMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return nil, nil, errUnsupportedField
+}
+
+type createUserRequestFailingMigration struct{}
+
+func (c *createUserRequestFailingMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	return nil, nil, errUnsupportedField
+}
+
+func Test_MigrationError(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-04-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&getUserResponseFailingMigration{},
+			&createUserRequestFailingMigration{},
+		},
+		"2023-04-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"engineering@getconvoy.io"}`))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+
+	err, _, _ = rm.Migrate(req, "createUser")
+	require.ErrorIs(t, err, errUnsupportedField)
+
+	var me *MigrationError
+	require.ErrorAs(t, err, &me)
+	require.Equal(t, MigrationError{
+		From:          "2023-02-01",
+		To:            "2023-03-01",
+		Handler:       "createUser",
+		Direction:     DirectionRequest,
+		MigrationName: "createUserRequestFailingMigration",
+		Err:           errUnsupportedField,
+	}, *me)
+
+	_, err = rm.Convert("2023-04-01", "2023-02-01", "getUser", []byte(`{}`))
+	require.ErrorIs(t, err, errUnsupportedField)
+	require.ErrorIs(t, err, ErrServerError)
+
+	require.ErrorAs(t, err, &me)
+	require.Equal(t, "2023-03-01", me.From)
+	require.Equal(t, "2023-02-01", me.To)
+	require.Equal(t, DirectionResponse, me.Direction)
+	require.Equal(t, "getUserResponseFailingMigration", me.MigrationName)
+}
+
+func Test_PreviewNextVersion(t *testing.T) {
+	// 2023-03-01 is registered ahead of its release, the handlers still
+	// serve 2023-02-01.
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-02-01",
+		VersionFormat:  DateFormat,
+		PreviewHeader:  "X-API-Preview",
+	})
+	require.NoError(t, err)
+	registerBasicMigrations(t, rm)
+
+	err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	oldBody := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	newBody := `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err, vw, rollback := rm.Migrate(r, "createUser")
+		require.NoError(t, err)
+		defer rollback(w)
+
+		payload, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, oldBody, string(payload))
+
+		vw.Write(payload)
+	})
+
+	tests := map[string]struct {
+		preview  string
+		body     string
+		expected string
+	}{
+		"preview": {
+			preview:  "next",
+			body:     newBody,
+			expected: newBody,
+		},
+		"no preview": {
+			body:     oldBody,
+			expected: oldBody,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Preview", tc.preview)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.JSONEq(t, tc.expected, rr.Body.String())
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-API-Preview", "next")
+	v, err := rm.getUserVersion(req)
+	require.NoError(t, err)
+	require.Equal(t, "2023-03-01", v.String())
+}
+
+type getUserMigration struct {
+	getUserResponseCombineNamesMigration
+}
+
+func Test_GenerateGraphviz(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-03-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	registerBasicMigrations(t, rm)
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterFunc("2023-02-01", `say"hi`, nil, nil)
+	require.NoError(t, err)
+
+	dot, err := rm.GenerateGraphviz()
+	require.NoError(t, err)
+	require.Equal(t, `digraph migrations {
+	rankdir=LR;
+	"0001-01-01" [label="initial", style=dashed];
+	"2023-02-01";
+	"2023-03-01" [style=bold];
+	"0001-01-01" -> "2023-02-01" [label="function migration for say\"hi"];
+	"2023-02-01" -> "2023-03-01" [label="getUserResponseCombineNamesMigration\ncreateUserRequestSplitNameMigration\ncreateUserResponseCombineNamesMigration"];
+}
+`, dot)
+}
+
+func Test_Lint(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "v2.0.0",
+		VersionFormat:  SemverFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		// prereleases sort before the initial version, v0.
+		"v0.0.0-alpha": Migrations{
+			&createUserRequestSplitNameMigration{},
+		},
+		"v1.0.0": Migrations{
+			&getUserResponseCombineNamesMigration{},
+			&createUserRequestSplitNameMigration{},
+			&getUserResponseLabelledMigration{},
+			&getUserMigration{},
+		},
+		"v2.0.0": Migrations{
+			&getUserResponseLabelledMigration{},
+			Directional(&createUserSplitNameMigration{}),
+		},
+	})
+	require.NoError(t, err)
+
+	var warnings []string
+	for _, w := range rm.Lint() {
+		warnings = append(warnings, w.Version+" "+w.Migration)
+	}
+
+	require.Equal(t, []string{
+		"v0.0.0-alpha createUserRequestSplitNameMigration",
+		"v1.0.0 getUserResponseLabelledMigration",
+		"v1.0.0 getUserMigration",
+	}, warnings)
+
+	rm = newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+	require.Empty(t, rm.Lint())
+}
+
+type getUserResponseLegacyFlagMigration struct{}
+
+func (c *getUserResponseLegacyFlagMigration) Migrate(
+	body []byte,
+	h http.Header) ([]byte, http.Header, error) {
+	var m map[string]any
+	err := json.Unmarshal(body, &m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// runs last, on the client's shape.
+	if _, ok := m["full_name"]; !ok {
+		return nil, nil, errors.New("expected full_name")
+	}
+
+	m["legacy"] = true
+	body, err = json.Marshal(m)
+	return body, h, err
+}
+
+func Test_RegisterConstraint(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "v2.0.0",
+		VersionFormat:  SemverFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"v1.0.0": Migrations{},
+		"v1.5.0": Migrations{},
+		"v2.0.0": Migrations{
+			&getUserResponseCombineNamesMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterConstraint(">=1.2.0 <2.0.0", &getUserResponseLegacyFlagMigration{})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		version  string
+		expected string
+	}{
+		"satisfied": {
+			version:  "v1.5.0",
+			expected: `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering","legacy":true}`,
+		},
+		"not satisfied": {
+			version:  "v1.0.0",
+			expected: `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`,
+		},
+		"current": {
+			version:  "v2.0.0",
+			expected: `{"email":"engineering@getconvoy.io","first_name":"Convoy","last_name":"Engineering"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("X-Test-Version", tc.version)
+			rr := httptest.NewRecorder()
+
+			getUser(t, rm).ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.JSONEq(t, tc.expected, rr.Body.String())
+		})
+	}
+
+	err = rm.RegisterConstraint("not a constraint", &getUserResponseLegacyFlagMigration{})
+	require.Error(t, err)
+
+	dates := newRequestMigration(t)
+	err = dates.RegisterConstraint(">=1.2.0", &getUserResponseLegacyFlagMigration{})
+	require.ErrorIs(t, err, ErrInvalidVersionFormat)
+}
+
+func Test_Plan(t *testing.T) {
+	rm, err := NewRequestMigration(&RequestMigrationOptions{
+		VersionHeader:  "X-Test-Version",
+		CurrentVersion: "2023-04-01",
+		VersionFormat:  DateFormat,
+	})
+	require.NoError(t, err)
+
+	err = rm.RegisterMigrations(MigrationStore{
+		"2023-02-01": Migrations{},
+		"2023-03-01": Migrations{
+			&createUserRequestSplitNameMigration{},
+			&createUserResponseCombineNamesMigration{},
+		},
+		"2023-04-01": Migrations{
+			&createUserResponsePlannedMigration{},
+		},
+	})
+	require.NoError(t, err)
+
+	payload := `{"email":"engineering@getconvoy.io","full_name":"Convoy Engineering"}`
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(payload))
+	req.Header.Set("X-Test-Version", "2023-02-01")
+
+	plan, err := rm.Plan(req, "createUser")
+	require.NoError(t, err)
+	require.Equal(t, []PlannedMigration{
+		{
+			Direction:   DirectionRequest,
+			From:        "2023-02-01",
+			To:          "2023-03-01",
+			Migration:   "createUserRequestSplitNameMigration",
+			Description: "createUserRequestSplitNameMigration",
+		},
+		{
+			Direction:   DirectionResponse,
+			From:        "2023-04-01",
+			To:          "2023-03-01",
+			Migration:   "createUserResponsePlannedMigration",
+			Description: "createUserResponsePlannedMigration",
+		},
+		{
+			Direction:   DirectionResponse,
+			From:        "2023-03-01",
+			To:          "2023-02-01",
+			Migration:   "createUserResponseCombineNamesMigration",
+			Description: "createUserResponseCombineNamesMigration",
+		},
+	}, plan)
+
+	// nothing was migrated.
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, payload, string(body))
+
+	req.Header.Set("X-Test-Version", "2023-04-01")
+	plan, err = rm.Plan(req, "createUser")
+	require.NoError(t, err)
+	require.Empty(t, plan)
+
+	req.Header.Set("X-Test-Version", "2023-01-15")
+	_, err = rm.Plan(req, "createUser")
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
+
+// createUserResponsePlannedMigration is only planned, never run.
+type createUserResponsePlannedMigration struct {
+	createUserResponseCombineNamesMigration
+}
+
+func Test_SetResponseVersionHeader(t *testing.T) {
+	tests := map[string]struct {
+		header   string
+		version  string
+		name     string
+		expected string
+	}{
+		"migrated": {
+			version:  "2023-02-01",
+			name:     "X-Test-Version",
+			expected: "2023-02-01",
+		},
+		"current": {
+			version:  "2023-03-01",
+			name:     "X-Test-Version",
+			expected: "2023-03-01",
+		},
+		"custom header": {
+			header:   "X-API-Version",
+			version:  "2023-02-01",
+			name:     "X-API-Version",
+			expected: "2023-02-01",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm, err := NewRequestMigration(&RequestMigrationOptions{
+				VersionHeader:            "X-Test-Version",
+				CurrentVersion:           "2023-03-01",
+				VersionFormat:            DateFormat,
+				SetResponseVersionHeader: true,
+				ResponseVersionHeader:    tc.header,
+			})
+			require.NoError(t, err)
+			registerBasicMigrations(t, rm)
+
+			err = rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("X-Test-Version", tc.version)
+			rr := httptest.NewRecorder()
+
+			getUser(t, rm).ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, tc.expected, rr.Header().Get(tc.name))
+		})
+	}
+
+	// it's opt-in.
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	rr := httptest.NewRecorder()
+	getUser(t, rm).ServeHTTP(rr, req)
+	require.Empty(t, rr.Header().Get("X-Test-Version"))
+}
+
+func Test_WillMigrate(t *testing.T) {
+	rm := newRequestMigration(t)
+	registerBasicMigrations(t, rm)
+
+	err := rm.RegisterMigrations(MigrationStore{"2023-02-01": Migrations{}})
+	require.NoError(t, err)
+
+	require.True(t, rm.WillMigrate("2023-02-01", "createUser", DirectionRequest))
+	require.True(t, rm.WillMigrate("2023-02-01", "createUser", DirectionResponse))
+	require.False(t, rm.WillMigrate("2023-02-01", "getUser", DirectionRequest))
+	require.True(t, rm.WillMigrate("2023-02-01", "getUser", DirectionResponse))
+	require.False(t, rm.WillMigrate("2023-03-01", "createUser", DirectionRequest))
+	require.False(t, rm.WillMigrate("2023-02-15", "createUser", DirectionRequest))
+
+	rm.ExcludeHandler("getUser")
+	require.False(t, rm.WillMigrate("2023-02-01", "getUser", DirectionResponse))
+
+	tests := map[string]struct {
+		target   string
+		header   string
+		code     int
+		expected string
+	}{
+		"version": {
+			target:   "/capabilities?handler=createUser&version=2023-02-01",
+			code:     http.StatusOK,
+			expected: `{"version":"2023-02-01","handler":"createUser","request":true,"response":true}`,
+		},
+		"caller version": {
+			target:   "/capabilities?handler=createUser",
+			header:   "2023-03-01",
+			code:     http.StatusOK,
+			expected: `{"version":"2023-03-01","handler":"createUser","request":false,"response":false}`,
+		},
+		"missing handler": {
+			target: "/capabilities?version=2023-02-01",
+			code:   http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.header != "" {
+				req.Header.Set("X-Test-Version", tc.header)
+			}
+			rr := httptest.NewRecorder()
+
+			rm.WillMigrateHandler().ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code)
+			if tc.expected != "" {
+				require.JSONEq(t, tc.expected, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package requestmigrations
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// VersionResolver retrieves the user's version from a request. It returns an
+// empty string when the request doesn't carry a version, so the next resolver
+// in the chain is tried.
+type VersionResolver func(req *http.Request) (string, error)
+
+// HeaderResolver resolves the version from the request header name.
+func HeaderResolver(name string) VersionResolver {
+	return func(req *http.Request) (string, error) {
+		return req.Header.Get(name), nil
+	}
+}
+
+// QueryResolver resolves the version from the query parameter name.
+func QueryResolver(name string) VersionResolver {
+	return func(req *http.Request) (string, error) {
+		return req.URL.Query().Get(name), nil
+	}
+}
+
+// CookieResolver resolves the version from the cookie name.
+func CookieResolver(name string) VersionResolver {
+	return func(req *http.Request) (string, error) {
+		cookie, err := req.Cookie(name)
+		if err != nil {
+			if errors.Is(err, http.ErrNoCookie) {
+				return "", nil
+			}
+
+			return "", err
+		}
+
+		return cookie.Value, nil
+	}
+}
+
+// PathResolver resolves the version from the first capture group of pattern
+// in the request's path, e.g. "2" from /v2/users with `^/v(\d+)/`. Paths that
+// don't match carry no version.
+func PathResolver(pattern *regexp.Regexp) VersionResolver {
+	return func(req *http.Request) (string, error) {
+		match := pattern.FindStringSubmatch(req.URL.Path)
+		if len(match) < 2 {
+			return "", nil
+		}
+
+		return match[1], nil
+	}
+}
+
+// FuncResolver resolves the version using fn. This is useful where the user
+// has a persistent version that isn't necessarily available in the request.
+func FuncResolver(fn GetUserVersionFunc) VersionResolver {
+	return VersionResolver(fn)
+}
+
+// defaultResolvers builds the resolution chain used when no VersionResolvers
+// are configured: the version header, then the path when path is set, then
+// the GetUserVersionFunc.
+func defaultResolvers(opts *RequestMigrationOptions, path *regexp.Regexp) []VersionResolver {
+	resolvers := []VersionResolver{HeaderResolver(opts.VersionHeader)}
+	if path != nil {
+		resolvers = append(resolvers, PathResolver(path))
+	}
+
+	if opts.GetUserVersionFunc != nil {
+		resolvers = append(resolvers, FuncResolver(opts.GetUserVersionFunc))
+	}
+
+	return resolvers
+}
+
+// negotiateVersion picks the version to use from a resolved value, which may
+// list several comma separated candidates, e.g. "2023-08-01, 2023-05-01". Of
+// the candidates, the newest registered version is picked, and
+// ErrUnknownVersion is returned if none are registered. A single version is
+// returned as is.
+func (rm *RequestMigration) negotiateVersion(vh string) (string, error) {
+	if !strings.Contains(vh, ",") {
+		return vh, nil
+	}
+
+	var candidates []*Version
+	for _, c := range strings.Split(vh, ",") {
+		v := rm.newVersion(strings.TrimSpace(c))
+		if v.IsValid() {
+			candidates = append(candidates, v)
+		}
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	for i := len(rm.versions) - 1; i >= 0; i-- {
+		v := rm.versions[i]
+		if v.String() == rm.iv {
+			continue
+		}
+
+		for _, c := range candidates {
+			if c.Equal(v) {
+				return v.String(), nil
+			}
+		}
+	}
+
+	return "", ErrUnknownVersion
+}
+
+// WithForcedVersion returns a copy of rm that resolves every request to
+// version v, regardless of its headers, e.g. to test a handler's behaviour
+// on a given version concisely. The copy starts with rm's migrations, but
+// registering migrations or excluding handlers on either afterwards doesn't
+// affect the other.
+func (rm *RequestMigration) WithForcedVersion(v string) *RequestMigration {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	opts := *rm.opts
+	opts.TenantVersionFunc = func(req *http.Request) (string, bool) {
+		return v, true
+	}
+
+	migrations := make(MigrationStore, len(rm.migrations))
+	for version, m := range rm.migrations {
+		migrations[version] = m
+	}
+
+	excluded := make(map[string]struct{}, len(rm.excluded))
+	for handler := range rm.excluded {
+		excluded[handler] = struct{}{}
+	}
+
+	// versions is sorted in place when versions are registered, so it's
+	// copied; the other slices are clipped, so appending to them copies.
+	return &RequestMigration{
+		opts:        &opts,
+		resolvers:   rm.resolvers,
+		current:     rm.current,
+		clock:       rm.clock,
+		envelope:    rm.envelope,
+		versions:    append([]*Version(nil), rm.versions...),
+		ordinals:    rm.ordinals,
+		metric:      rm.metric,
+		iv:          rm.iv,
+		migrations:  migrations,
+		constrained: rm.constrained[:len(rm.constrained):len(rm.constrained)],
+		excluded:    excluded,
+		preHooks:    rm.preHooks[:len(rm.preHooks):len(rm.preHooks)],
+		postHooks:   rm.postHooks[:len(rm.postHooks):len(rm.postHooks)],
+	}
+}
@@ -19,3 +19,22 @@ func (r *response) Header(header http.Header) {
 func (r *response) SetHeader(statusCode int) {
 	r.statusCode = statusCode
 }
+
+// setResponseVersion sets the header reporting the version a response is
+// served as, if SetResponseVersionHeader is set.
+func (rm *RequestMigration) setResponseVersion(h http.Header, v *Version) {
+	if !rm.opts.SetResponseVersionHeader || h == nil {
+		return
+	}
+
+	name := rm.opts.ResponseVersionHeader
+	if isStringEmpty(name) {
+		name = rm.opts.VersionHeader
+	}
+
+	if isStringEmpty(name) {
+		return
+	}
+
+	h.Set(name, v.String())
+}
@@ -0,0 +1,65 @@
+package requestmigrations
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var ErrScopeNotObject = errors.New("scoped migrations require a JSON object body")
+
+// ScopedMigration is implemented by migrations that only read and write some
+// of the body's top-level keys, e.g. "data" in an envelope that also carries
+// "status" and "message". The migration receives an object holding just
+// those keys, and its result is merged back into the body: scoped keys it
+// returns are replaced, scoped keys it drops are removed, and every other key
+// is left untouched.
+type ScopedMigration interface {
+	Scope() []string
+}
+
+// migrateScope runs fn on the keys of data in scope and merges its result
+// back into data.
+func migrateScope(scope []string, data []byte, header http.Header, fn MigrateFunc) ([]byte, http.Header, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil || body == nil {
+		return nil, nil, ErrScopeNotObject
+	}
+
+	in := make(map[string]json.RawMessage, len(scope))
+	for _, key := range scope {
+		if v, ok := body[key]; ok {
+			in[key] = v
+		}
+	}
+
+	scoped, err := json.Marshal(in)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scoped, header, err = fn(scoped, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(scoped, &out); err != nil || out == nil {
+		return nil, nil, ErrScopeNotObject
+	}
+
+	for _, key := range scope {
+		if v, ok := out[key]; ok {
+			body[key] = v
+		} else {
+			delete(body, key)
+		}
+	}
+
+	data, err = json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, header, nil
+}
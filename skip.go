@@ -0,0 +1,31 @@
+package requestmigrations
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const defaultSkipHeader = "X-Skip-Migrations"
+
+// skipMigrations reports whether the request asked to bypass migrations and
+// is allowed to.
+func (rm *RequestMigration) skipMigrations(r *http.Request, handler string) bool {
+	if !rm.opts.AllowSkipHeader {
+		return false
+	}
+
+	name := rm.opts.SkipHeader
+	if isStringEmpty(name) {
+		name = defaultSkipHeader
+	}
+
+	skip, err := strconv.ParseBool(r.Header.Get(name))
+	if err != nil || !skip {
+		return false
+	}
+
+	log.Printf("requestmigrations: skipping migrations for %s %s on handler %s: %s is set",
+		r.Method, r.URL.Path, handler, name)
+	return true
+}
@@ -0,0 +1,109 @@
+package requestmigrations
+
+// RegistrySnapshot records the registered versions, oldest first, and the
+// migrations registered for each, identified by their description.
+type RegistrySnapshot struct {
+	Versions   []string            `json:"versions"`
+	Migrations map[string][]string `json:"migrations"`
+}
+
+// RegistryDiff lists what changed between two snapshots. Migrations are keyed
+// by version, and those of added or removed versions are listed too.
+type RegistryDiff struct {
+	AddedVersions     []string            `json:"added_versions,omitempty"`
+	RemovedVersions   []string            `json:"removed_versions,omitempty"`
+	AddedMigrations   map[string][]string `json:"added_migrations,omitempty"`
+	RemovedMigrations map[string][]string `json:"removed_migrations,omitempty"`
+}
+
+// Empty reports whether the snapshots were the same.
+func (d *RegistryDiff) Empty() bool {
+	return len(d.AddedVersions) == 0 && len(d.RemovedVersions) == 0 &&
+		len(d.AddedMigrations) == 0 && len(d.RemovedMigrations) == 0
+}
+
+// Snapshot returns the registered versions and migrations, e.g. to compare
+// them with Diff after migrations are reloaded.
+func (rm *RequestMigration) Snapshot() RegistrySnapshot {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	snapshot := RegistrySnapshot{
+		Versions:   []string{},
+		Migrations: make(map[string][]string),
+	}
+
+	for _, v := range rm.versions {
+		// the initial version is internal, it can't change.
+		if v.String() == rm.iv {
+			continue
+		}
+
+		key := v.String()
+		snapshot.Versions = append(snapshot.Versions, key)
+
+		descriptions := []string{}
+		for _, migration := range rm.migrations[key] {
+			descriptions = append(descriptions, describe(migration))
+		}
+		snapshot.Migrations[key] = descriptions
+	}
+
+	return snapshot
+}
+
+// Diff returns what changed in the registered versions and migrations since
+// old was taken.
+func (rm *RequestMigration) Diff(old RegistrySnapshot) RegistryDiff {
+	current := rm.Snapshot()
+
+	diff := RegistryDiff{
+		AddedVersions:     subtract(current.Versions, old.Versions),
+		RemovedVersions:   subtract(old.Versions, current.Versions),
+		AddedMigrations:   make(map[string][]string),
+		RemovedMigrations: make(map[string][]string),
+	}
+
+	for _, v := range current.Versions {
+		if added := subtract(current.Migrations[v], old.Migrations[v]); len(added) > 0 {
+			diff.AddedMigrations[v] = added
+		}
+	}
+
+	for _, v := range old.Versions {
+		if removed := subtract(old.Migrations[v], current.Migrations[v]); len(removed) > 0 {
+			diff.RemovedMigrations[v] = removed
+		}
+	}
+
+	if len(diff.AddedMigrations) == 0 {
+		diff.AddedMigrations = nil
+	}
+
+	if len(diff.RemovedMigrations) == 0 {
+		diff.RemovedMigrations = nil
+	}
+
+	return diff
+}
+
+// subtract returns the elements of a missing from b, keeping a's order. An
+// element appearing n times in b cancels out n of its occurrences in a.
+func subtract(a, b []string) []string {
+	counts := make(map[string]int, len(b))
+	for _, s := range b {
+		counts[s]++
+	}
+
+	var out []string
+	for _, s := range a {
+		if counts[s] > 0 {
+			counts[s]--
+			continue
+		}
+
+		out = append(out, s)
+	}
+
+	return out
+}
@@ -0,0 +1,21 @@
+package requestmigrations
+
+// StatusMigration is implemented by response migrations that only apply to
+// some status codes, e.g. a migration reshaping success bodies that must
+// leave error bodies alone. Migrations that don't implement it run for
+// every status code.
+type StatusMigration interface {
+	AppliesToStatus(code int) bool
+}
+
+// appliesToStatus reports whether migration should run on a response with
+// status code. A zero code, when the status is unknown, matches every
+// migration.
+func appliesToStatus(migration Migration, code int) bool {
+	sm, ok := unwrapMigration(migration).(StatusMigration)
+	if !ok || code == 0 {
+		return true
+	}
+
+	return sm.AppliesToStatus(code)
+}
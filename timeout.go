@@ -0,0 +1,95 @@
+package requestmigrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrMigrationTimeout         = errors.New("migration timed out")
+	ErrMigrationReturnedNilBody = errors.New("migration returned a nil body")
+)
+
+// ContextMigration is implemented by migrations that accept a context, e.g.
+// because they call out to other services. When a migration implements it,
+// MigrateContext is called instead of Migrate, and it should return once ctx
+// is done.
+type ContextMigration interface {
+	MigrateContext(ctx context.Context, data []byte, header http.Header) ([]byte, http.Header, error)
+}
+
+type migrationResult struct {
+	data   []byte
+	header http.Header
+	err    error
+}
+
+// migrate runs migration, bounded by the migrator's timeout if one is set.
+// Migrations that don't implement ContextMigration can't be interrupted, so on
+// timeout they're left to finish in the background and their result is
+// discarded.
+func (m *migrator) migrate(ctx context.Context, migration Migration, direction Direction, data []byte, header http.Header) ([]byte, http.Header, error) {
+	if m.timeout <= 0 {
+		return callMigration(ctx, migration, direction, data, header)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	// the migration gets its own header, as on timeout it may still be
+	// changing it while the caller serves the payload un-migrated.
+	mh := header.Clone()
+
+	done := make(chan migrationResult, 1)
+	go func() {
+		data, header, err := callMigration(ctx, migration, direction, data, mh)
+		done <- migrationResult{data: data, header: header, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.data, res.header, res.err
+	case <-ctx.Done():
+		return nil, nil, ErrMigrationTimeout
+	}
+}
+
+func callMigration(ctx context.Context, migration Migration, direction Direction, data []byte, header http.Header) ([]byte, http.Header, error) {
+	if sm, ok := unwrapMigration(migration).(ScopedMigration); ok {
+		return migrateScope(sm.Scope(), data, header, func(data []byte, header http.Header) ([]byte, http.Header, error) {
+			return invokeMigration(ctx, migration, direction, data, header)
+		})
+	}
+
+	return invokeMigration(ctx, migration, direction, data, header)
+}
+
+func invokeMigration(ctx context.Context, migration Migration, direction Direction, data []byte, header http.Header) ([]byte, http.Header, error) {
+	var err error
+	if dm, ok := asDirectional(migration); ok {
+		if direction == DirectionResponse {
+			data, header, err = dm.MigrateResponse(data, header)
+		} else {
+			data, header, err = dm.MigrateRequest(data, header)
+		}
+	} else if hm, ok := unwrapMigration(migration).(HeaderMigration); ok {
+		data, header, err = migrateHeader(hm, data, header)
+	} else if cm, ok := migration.(ContextMigration); ok {
+		data, header, err = cm.MigrateContext(ctx, data, header)
+	} else {
+		data, header, err = migration.Migrate(data, header)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a nil body would otherwise be served as an empty response.
+	if data == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrMigrationReturnedNilBody, migrationName(migration))
+	}
+
+	return data, header, nil
+}
@@ -0,0 +1,114 @@
+package requestmigrations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeFormat is a representation of a timestamp TimestampFormat converts
+// fields between.
+type TimeFormat string
+
+const (
+	// EpochSeconds is a JSON number of seconds since the Unix epoch.
+	EpochSeconds TimeFormat = "epoch_seconds"
+	// EpochMillis is a JSON number of milliseconds since the Unix epoch.
+	EpochMillis TimeFormat = "epoch_millis"
+	// RFC3339 is a string such as "2023-03-01T12:00:00Z".
+	RFC3339 TimeFormat = "rfc3339"
+)
+
+// TimestampFormat returns a transform converting the timestamp field name
+// from the format from to the format to, e.g. a created_at served as epoch
+// seconds by one version and as RFC3339 by the next. Epoch timestamps carry
+// no zone, so they're read and written as UTC, and RFC3339 timestamps in
+// other zones are converted to UTC. Precision the format to can't hold, e.g.
+// milliseconds converted to epoch seconds, is truncated. Null values and
+// bodies without name are left untouched, while values that aren't in the
+// format from fail the transform. Its inverse is
+// TimestampFormat(name, to, from).
+func TimestampFormat(name string, from, to TimeFormat) FieldTransform {
+	return func(m map[string]any) error {
+		v, ok := m[name]
+		if !ok || v == nil {
+			return nil
+		}
+
+		t, err := parseTimestamp(v, from)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+
+		tv, err := formatTimestamp(t, to)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+
+		m[name] = tv
+		return nil
+	}
+}
+
+// parseTimestamp returns the time v, in the format f, represents.
+func parseTimestamp(v any, f TimeFormat) (time.Time, error) {
+	switch f {
+	case EpochSeconds, EpochMillis:
+		s, err := scalarString(v, NumberField)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		unit := time.Second
+		if f == EpochMillis {
+			unit = time.Millisecond
+		}
+
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			if f == EpochMillis {
+				return time.UnixMilli(n).UTC(), nil
+			}
+
+			return time.Unix(n, 0).UTC(), nil
+		}
+
+		// fractional timestamps, e.g. 1677672000.5.
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s is not an epoch timestamp", s)
+		}
+
+		return time.Unix(0, int64(n*float64(unit))).UTC(), nil
+
+	case RFC3339:
+		s, ok := v.(string)
+		if !ok {
+			return time.Time{}, errors.New("value is not an RFC3339 timestamp")
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not an RFC3339 timestamp", s)
+		}
+
+		return t.UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time format %q", f)
+}
+
+// formatTimestamp returns t in the format f.
+func formatTimestamp(t time.Time, f TimeFormat) (any, error) {
+	switch f {
+	case EpochSeconds:
+		return json.Number(strconv.FormatInt(t.Unix(), 10)), nil
+	case EpochMillis:
+		return json.Number(strconv.FormatInt(t.UnixMilli(), 10)), nil
+	case RFC3339:
+		return t.Format(time.RFC3339Nano), nil
+	}
+
+	return nil, fmt.Errorf("unknown time format %q", f)
+}
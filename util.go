@@ -1,6 +1,79 @@
 package requestmigrations
 
-import "strings"
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
 
 // IsStringEmpty checks if the given string s is empty or not
 func isStringEmpty(s string) bool { return len(strings.TrimSpace(s)) == 0 }
+
+// hasEmptyHeader reports whether r sent the header name with an empty or
+// whitespace value.
+func hasEmptyHeader(r *http.Request, name string) bool {
+	if isStringEmpty(name) {
+		return false
+	}
+
+	values := r.Header.Values(name)
+	return len(values) > 0 && isStringEmpty(strings.Join(values, ""))
+}
+
+// isJSONContent checks if a payload is JSON. The Content-Type header takes
+// precedence, the body is only sniffed when the header is absent.
+func isJSONContent(header http.Header, body []byte) bool {
+	ct := header.Get("Content-Type")
+	if isStringEmpty(ct) {
+		return json.Valid(body)
+	}
+
+	mt, ok := baseMediaType(ct)
+	if !ok {
+		return false
+	}
+
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// baseMediaType returns the media type of the Content-Type ct, lowercased and
+// without its parameters, and whether it's well formed. Unlike
+// mime.ParseMediaType it doesn't parse the parameters, so it doesn't
+// allocate; it runs for every response.
+func baseMediaType(ct string) (string, bool) {
+	mt, _, _ := strings.Cut(ct, ";")
+	mt = strings.TrimSpace(mt)
+
+	typ, sub, hasSub := strings.Cut(mt, "/")
+	if !isToken(typ) || (hasSub && !isToken(sub)) {
+		return "", false
+	}
+
+	return strings.ToLower(mt), true
+}
+
+// isToken reports whether s is a token as defined by RFC 1521.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?=`, c) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasBody reports whether r carries a body to migrate. HEAD requests are
+// treated as bodyless.
+func hasBody(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+
+	return r.Body != nil && r.Body != http.NoBody
+}
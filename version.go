@@ -1,6 +1,7 @@
 package requestmigrations
 
 import (
+	"math"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
@@ -11,6 +12,22 @@ type Version struct {
 	Value  interface{}
 }
 
+// NewVersion returns the version value in format. It returns
+// ErrInvalidVersionFormat if format isn't supported or value isn't a version
+// in format.
+func NewVersion(format VersionFormat, value string) (*Version, error) {
+	if format != DateFormat && format != SemverFormat {
+		return nil, ErrInvalidVersionFormat
+	}
+
+	v := &Version{Format: format, Value: value}
+	if !v.IsValid() {
+		return nil, ErrInvalidVersionFormat
+	}
+
+	return v, nil
+}
+
 func (v *Version) IsValid() bool {
 	switch v.Format {
 	case SemverFormat:
@@ -30,6 +47,10 @@ func (v *Version) IsValid() bool {
 }
 
 func (v *Version) Equal(vv *Version) bool {
+	if v.Format != vv.Format {
+		return false
+	}
+
 	switch v.Format {
 	case SemverFormat:
 		sv, err := semver.NewVersion(v.Value.(string))
@@ -60,24 +81,114 @@ func (v *Version) Equal(vv *Version) bool {
 
 	return false
 }
+
+// Compare returns -1, 0 or 1 if v is older than, the same as or newer than
+// vv. Versions in different formats are ordered by format, every DateFormat
+// version being older than every SemverFormat one, as a scheme is expected
+// to move from dates to semver. Invalid versions sort first.
+func (v *Version) Compare(vv *Version) int {
+	if v.Format != vv.Format {
+		return compareInts(formatRank(v.Format), formatRank(vv.Format))
+	}
+
+	switch v.Format {
+	case SemverFormat:
+		sv, err := semver.NewVersion(v.Value.(string))
+		if err != nil {
+			return -1
+		}
+
+		svv, err := semver.NewVersion(vv.Value.(string))
+		if err != nil {
+			return 1
+		}
+
+		return sv.Compare(svv)
+
+	case DateFormat:
+		tv, err := time.Parse(time.DateOnly, v.Value.(string))
+		if err != nil {
+			return -1
+		}
+
+		tvv, err := time.Parse(time.DateOnly, vv.Value.(string))
+		if err != nil {
+			return 1
+		}
+
+		return tv.Compare(tvv)
+	}
+
+	return 0
+}
+
+func formatRank(format VersionFormat) int {
+	switch format {
+	case DateFormat:
+		return 0
+	case SemverFormat:
+		return 1
+	}
+
+	return -1
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// DetectVersionFormat returns DateFormat for versions that are dates and
+// SemverFormat otherwise. It's meant as a VersionFormatFunc while moving a
+// version scheme from dates to semver.
+func DetectVersionFormat(v string) VersionFormat {
+	_, err := time.Parse(time.DateOnly, v)
+	if err == nil {
+		return DateFormat
+	}
+
+	return SemverFormat
+}
+
 func (v *Version) String() string {
 	return v.Value.(string)
 }
 
-func dateVersionSorter(versions []*Version) func(i, j int) bool {
-	return func(i, j int) bool {
-		it, err := time.Parse(time.DateOnly, versions[i].Value.(string))
-		if err != nil {
-			return false
-		}
+// dateVersions sorts date versions by their day number, so each date is
+// parsed once per sort rather than on every comparison.
+type dateVersions struct {
+	versions []*Version
+	days     []int64
+}
 
-		jt, err := time.Parse(time.DateOnly, versions[j].Value.(string))
+func newDateVersions(versions []*Version) dateVersions {
+	days := make([]int64, len(versions))
+	for i, v := range versions {
+		t, err := time.Parse(time.DateOnly, v.Value.(string))
 		if err != nil {
-			return false
+			// invalid versions sort first, as with Compare.
+			days[i] = math.MinInt64
+			continue
 		}
 
-		return it.Before(jt)
+		days[i] = t.Unix() / 86400
 	}
+
+	return dateVersions{versions: versions, days: days}
+}
+
+func (d dateVersions) Len() int           { return len(d.versions) }
+func (d dateVersions) Less(i, j int) bool { return d.days[i] < d.days[j] }
+
+func (d dateVersions) Swap(i, j int) {
+	d.versions[i], d.versions[j] = d.versions[j], d.versions[i]
+	d.days[i], d.days[j] = d.days[j], d.days[i]
 }
 
 func semVerSorter(versions []*Version) func(i, j int) bool {
@@ -95,3 +206,10 @@ func semVerSorter(versions []*Version) func(i, j int) bool {
 		return is.LessThan(js)
 	}
 }
+
+// mixedVersionSorter sorts versions that may not share a format.
+func mixedVersionSorter(versions []*Version) func(i, j int) bool {
+	return func(i, j int) bool {
+		return versions[i].Compare(versions[j]) < 0
+	}
+}